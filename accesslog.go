@@ -0,0 +1,270 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tango
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the formats of AccessLog
+const (
+	// AccessLogCommon is the Apache Common Log Format
+	AccessLogCommon = `{remote} - {user} [{time}] "{method} {uri} {proto}" {status} {bytes}`
+	// AccessLogCombined is the Apache Combined Log Format
+	AccessLogCombined = AccessLogCommon + ` "{referer}" "{user_agent}"`
+	// AccessLogJSON writes a JSON object per line
+	AccessLogJSON = "json"
+)
+
+// HeaderXRequestID is the header of the request ID
+const HeaderXRequestID = "X-Request-ID"
+
+// AccessLogOptions defines the options of AccessLog
+type AccessLogOptions struct {
+	// Output is the writer of the access log, default is os.Stdout
+	Output io.Writer
+	// Format is AccessLogCommon, AccessLogCombined, AccessLogJSON or a
+	// template with the tokens {remote}, {user}, {time}, {time_rfc3339},
+	// {method}, {uri}, {path}, {proto}, {host}, {status}, {bytes},
+	// {latency_us}, {latency}, {referer}, {user_agent}, {request_id},
+	// {route} and {fields}, the fields added by Context.AddLogFields as
+	// key=value. The JSON lines have these fields too. Default is
+	// AccessLogCombined.
+	Format string
+	// SampleRate is the ratio of the logged requests between 0 and 1, the
+	// responses with a status of 500 or more are always logged. Default is
+	// logging every request.
+	SampleRate float64
+	// SkipPaths are the URL paths never logged, e.g. /healthz
+	SkipPaths []string
+	// Skip returns true if the request should not be logged
+	Skip func(ctx *Context) bool
+}
+
+// accessRecord is a line of the access log
+type accessRecord struct {
+	Time      time.Time `json:"time"`
+	Remote    string    `json:"remote"`
+	User      string    `json:"user,omitempty"`
+	Method    string    `json:"method"`
+	URI       string    `json:"uri"`
+	Path      string    `json:"path"`
+	Proto     string    `json:"proto"`
+	Host      string    `json:"host"`
+	Status    int       `json:"status"`
+	Bytes     int       `json:"bytes"`
+	LatencyUs int64     `json:"latency_us"`
+	Referer   string    `json:"referer,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	Route     string    `json:"route,omitempty"`
+
+	latency time.Duration
+	fields  []interface{}
+}
+
+// writeJSON writes the record and its fields as a JSON object
+func (r *accessRecord) writeJSON(buf *bytes.Buffer) {
+	json.NewEncoder(buf).Encode(r)
+	// remove "}\n" to add the fields
+	buf.Truncate(buf.Len() - 2)
+	for i := 0; i+1 < len(r.fields); i += 2 {
+		key, err := json.Marshal(fmt.Sprint(r.fields[i]))
+		if err != nil {
+			continue
+		}
+		value, err := json.Marshal(r.fields[i+1])
+		if err != nil {
+			value, _ = json.Marshal(fmt.Sprint(r.fields[i+1]))
+		}
+		buf.WriteByte(',')
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+}
+
+// accessTokens are the tokens of the access log templates
+var accessTokens = map[string]func(buf *bytes.Buffer, r *accessRecord){
+	"remote":       func(buf *bytes.Buffer, r *accessRecord) { writeLogString(buf, r.Remote) },
+	"user":         func(buf *bytes.Buffer, r *accessRecord) { writeLogString(buf, r.User) },
+	"time":         func(buf *bytes.Buffer, r *accessRecord) { buf.WriteString(r.Time.Format("02/Jan/2006:15:04:05 -0700")) },
+	"time_rfc3339": func(buf *bytes.Buffer, r *accessRecord) { buf.WriteString(r.Time.Format(time.RFC3339)) },
+	"method":       func(buf *bytes.Buffer, r *accessRecord) { writeLogString(buf, r.Method) },
+	"uri":          func(buf *bytes.Buffer, r *accessRecord) { writeLogString(buf, r.URI) },
+	"path":         func(buf *bytes.Buffer, r *accessRecord) { writeLogString(buf, r.Path) },
+	"proto":        func(buf *bytes.Buffer, r *accessRecord) { writeLogString(buf, r.Proto) },
+	"host":         func(buf *bytes.Buffer, r *accessRecord) { writeLogString(buf, r.Host) },
+	"status":       func(buf *bytes.Buffer, r *accessRecord) { buf.WriteString(strconv.Itoa(r.Status)) },
+	"bytes": func(buf *bytes.Buffer, r *accessRecord) {
+		if r.Bytes == 0 {
+			buf.WriteByte('-')
+			return
+		}
+		buf.WriteString(strconv.Itoa(r.Bytes))
+	},
+	"latency_us": func(buf *bytes.Buffer, r *accessRecord) { buf.WriteString(strconv.FormatInt(r.LatencyUs, 10)) },
+	"latency":    func(buf *bytes.Buffer, r *accessRecord) { buf.WriteString(r.latency.String()) },
+	"referer":    func(buf *bytes.Buffer, r *accessRecord) { writeLogString(buf, r.Referer) },
+	"user_agent": func(buf *bytes.Buffer, r *accessRecord) { writeLogString(buf, r.UserAgent) },
+	"request_id": func(buf *bytes.Buffer, r *accessRecord) { writeLogString(buf, r.RequestID) },
+	"route":      func(buf *bytes.Buffer, r *accessRecord) { writeLogString(buf, r.Route) },
+	"fields":     func(buf *bytes.Buffer, r *accessRecord) { buf.WriteString(formatFields(r.fields)) },
+}
+
+// writeLogString writes s with the quotes and the control characters
+// escaped, an empty string is written as "-"
+func writeLogString(buf *bytes.Buffer, s string) {
+	if s == "" {
+		buf.WriteByte('-')
+		return
+	}
+	q := strconv.Quote(s)
+	buf.WriteString(q[1 : len(q)-1])
+}
+
+// compileAccessFormat returns a function writing a record as the template
+func compileAccessFormat(format string) (func(buf *bytes.Buffer, r *accessRecord), error) {
+	var parts []func(buf *bytes.Buffer, r *accessRecord)
+	for len(format) > 0 {
+		start := strings.IndexByte(format, '{')
+		if start < 0 {
+			start = len(format)
+		}
+		if start > 0 {
+			literal := format[:start]
+			parts = append(parts, func(buf *bytes.Buffer, r *accessRecord) { buf.WriteString(literal) })
+			format = format[start:]
+			continue
+		}
+		end := strings.IndexByte(format, '}')
+		if end < 0 {
+			return nil, fmt.Errorf("tango: unclosed access log token %q", format)
+		}
+		token, ok := accessTokens[format[1:end]]
+		if !ok {
+			return nil, fmt.Errorf("tango: unknown access log token %q", format[:end+1])
+		}
+		parts = append(parts, token)
+		format = format[end+1:]
+	}
+	return func(buf *bytes.Buffer, r *accessRecord) {
+		for _, part := range parts {
+			part(buf, r)
+		}
+	}, nil
+}
+
+// AccessLog returns a middleware writing a line per request to the Output,
+// it should be added before the other middlewares. It panics if the Format
+// is invalid.
+func AccessLog(opts ...AccessLogOptions) HandlerFunc {
+	var opt AccessLogOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.Output == nil {
+		opt.Output = os.Stdout
+	}
+	if opt.Format == "" {
+		opt.Format = AccessLogCombined
+	}
+
+	var format func(buf *bytes.Buffer, r *accessRecord)
+	if opt.Format == AccessLogJSON {
+		format = func(buf *bytes.Buffer, r *accessRecord) {
+			r.writeJSON(buf)
+		}
+	} else {
+		var err error
+		format, err = compileAccessFormat(opt.Format)
+		if err != nil {
+			panic(err)
+		}
+	}
+	skipPaths := make(map[string]bool, len(opt.SkipPaths))
+	for _, p := range opt.SkipPaths {
+		skipPaths[p] = true
+	}
+
+	var lock sync.Mutex
+	bufPool := sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+	return func(ctx *Context) {
+		start := time.Now()
+		req := ctx.Req()
+		if skipPaths[req.URL.Path] {
+			ctx.Next()
+			return
+		}
+
+		ctx.Next()
+
+		if !ctx.Written() {
+			if ctx.Result == nil {
+				ctx.Result = NotFound()
+			}
+			ctx.HandleError()
+		}
+
+		status := ctx.Status()
+		if status < 500 && opt.SampleRate > 0 && opt.SampleRate < 1 && rand.Float64() >= opt.SampleRate {
+			return
+		}
+		if opt.Skip != nil && opt.Skip(ctx) {
+			return
+		}
+
+		latency := time.Since(start)
+		r := accessRecord{
+			Time:      start,
+			Remote:    ctx.IP(),
+			Method:    req.Method,
+			URI:       req.RequestURI,
+			Path:      req.URL.Path,
+			Proto:     req.Proto,
+			Host:      req.Host,
+			Status:    status,
+			Bytes:     ctx.Size(),
+			LatencyUs: latency.Microseconds(),
+			Referer:   req.Referer(),
+			UserAgent: req.UserAgent(),
+			RequestID: ctx.RequestID(),
+			latency:   latency,
+			fields:    ctx.LogFields(),
+		}
+		if r.RequestID == "" {
+			r.RequestID = ctx.Header().Get(HeaderXRequestID)
+		}
+		if r.URI == "" {
+			r.URI = req.URL.RequestURI()
+		}
+		if user, _, ok := req.BasicAuth(); ok {
+			r.User = user
+		}
+		if route := ctx.Route(); route != nil {
+			r.Route = route.Pattern()
+		}
+
+		buf := bufPool.Get().(*bytes.Buffer)
+		buf.Reset()
+		format(buf, &r)
+		buf.WriteByte('\n')
+		lock.Lock()
+		opt.Output.Write(buf.Bytes())
+		lock.Unlock()
+		bufPool.Put(buf)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tango
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func testAccessLog(t *testing.T, opt AccessLogOptions, url string, headers ...string) string {
+	buff := bytes.NewBufferString("")
+	opt.Output = buff
+	o := New(AccessLog(opt), Return())
+	o.Get("/users/:id", func() string {
+		return "user"
+	})
+	o.Get("/fail", func() error {
+		return Abort(http.StatusBadGateway, "fail")
+	})
+	o.Get("/healthz", func() string {
+		return "ok"
+	})
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.RemoteAddr = "192.168.1.2:1234"
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	o.ServeHTTP(httptest.NewRecorder(), req)
+	return buff.String()
+}
+
+func TestAccessLogCombined(t *testing.T) {
+	line := testAccessLog(t, AccessLogOptions{}, "http://localhost:8000/users/5?a=1",
+		"Referer", "http://example.com/", "User-Agent", `curl "7"`)
+	re := regexp.MustCompile(`^192\.168\.1\.2 - - \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [-+]\d{4}\] "GET /users/5\?a=1 HTTP/1\.1" 200 4 "http://example\.com/" "curl \\"7\\""\n$`)
+	expect(t, re.MatchString(line), true)
+
+	line = testAccessLog(t, AccessLogOptions{Format: AccessLogCommon}, "http://localhost:8000/missing")
+	expect(t, strings.Contains(line, `"GET /missing HTTP/1.1" 404 9`), true)
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	line := testAccessLog(t, AccessLogOptions{Format: AccessLogJSON}, "http://localhost:8000/users/5",
+		HeaderXRequestID, "abc")
+	var record map[string]interface{}
+	expect(t, json.Unmarshal([]byte(line), &record), nil)
+	expect(t, record["remote"], "192.168.1.2")
+	expect(t, record["status"], float64(200))
+	expect(t, record["bytes"], float64(4))
+	expect(t, record["route"], "/users/:id")
+	expect(t, record["path"], "/users/5")
+	_, ok := record["latency_us"]
+	expect(t, ok, true)
+}
+
+func TestAccessLogTemplate(t *testing.T) {
+	line := testAccessLog(t, AccessLogOptions{Format: "{method} {route} {status} {bytes} {latency_us}us {host}"},
+		"http://localhost:8000/users/5")
+	re := regexp.MustCompile(`^GET /users/:id 200 4 \d+us localhost:8000\n$`)
+	expect(t, re.MatchString(line), true)
+
+	for _, format := range []string{"{unknown}", "{method"} {
+		func() {
+			defer func() {
+				refute(t, recover(), nil)
+			}()
+			AccessLog(AccessLogOptions{Format: format})
+		}()
+	}
+}
+
+func TestAccessLogSkip(t *testing.T) {
+	opt := AccessLogOptions{
+		SampleRate: 0.000001,
+		SkipPaths:  []string{"/healthz"},
+	}
+	expect(t, testAccessLog(t, opt, "http://localhost:8000/users/5"), "")
+	expect(t, testAccessLog(t, opt, "http://localhost:8000/healthz"), "")
+	// the server errors are always logged
+	refute(t, testAccessLog(t, opt, "http://localhost:8000/fail"), "")
+
+	opt = AccessLogOptions{Skip: func(ctx *Context) bool {
+		return ctx.Status() == http.StatusOK
+	}}
+	expect(t, testAccessLog(t, opt, "http://localhost:8000/users/5"), "")
+	refute(t, testAccessLog(t, opt, "http://localhost:8000/missing"), "")
+}
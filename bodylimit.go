@@ -0,0 +1,165 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tango
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// DefaultBodyLimit is the default maximum size of a request body
+const DefaultBodyLimit int64 = 4 << 20
+
+// BodyTooLargeError is returned when reading a request body larger than
+// the limit, it implements AbortError so the action could return it directly.
+type BodyTooLargeError struct {
+	Limit int64
+}
+
+// Code returns http.StatusRequestEntityTooLarge
+func (e *BodyTooLargeError) Code() int {
+	return http.StatusRequestEntityTooLarge
+}
+
+func (e *BodyTooLargeError) Error() string {
+	return fmt.Sprintf("request body is larger than %d bytes", e.Limit)
+}
+
+// bodyError converts the errors of http.MaxBytesReader to BodyTooLargeError
+func bodyError(err error) error {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return &BodyTooLargeError{maxErr.Limit}
+	}
+	return err
+}
+
+// BodyLimiter is implemented by the actions which override the body limit,
+// a negative limit means no limit
+type BodyLimiter interface {
+	BodyLimit() int64
+}
+
+// BodyLimitOptions defines the options of BodyLimit
+type BodyLimitOptions struct {
+	// Limit is the maximum size of the request body, default is DefaultBodyLimit,
+	// a negative limit means no limit
+	Limit int64
+	// ReadTimeout is the maximum duration to read the request body, so that
+	// the slow clients could not keep the connection. Default is no timeout.
+	ReadTimeout time.Duration
+}
+
+// limitedBody remembers the original body, so that the limit could be
+// overridden by the route middlewares
+type limitedBody struct {
+	io.ReadCloser
+	orig io.ReadCloser
+	// done is called when the whole body has been read
+	done   func()
+	header http.Header
+	// err is the BodyTooLargeError once the limit is reached
+	err *BodyTooLargeError
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF && b.done != nil {
+		b.done()
+		b.done = nil
+	} else if err != nil && err != io.EOF {
+		// the rest of the body won't be read, so the connection could
+		// not be reused
+		b.header.Set("Connection", "close")
+		if tooLarge, ok := bodyError(err).(*BodyTooLargeError); ok {
+			b.err = tooLarge
+		}
+	}
+	return n, err
+}
+
+// bodyLimitError returns the BodyTooLargeError if reading the body of req
+// reached the limit, e.g. when parsing the form which ignores the errors
+func bodyLimitError(req *http.Request) error {
+	if lb, ok := req.Body.(*limitedBody); ok && lb.err != nil {
+		return lb.err
+	}
+	return nil
+}
+
+// errorBody is a body returning err for every read
+type errorBody struct {
+	err error
+	io.Closer
+}
+
+func (b errorBody) Read(p []byte) (int, error) {
+	return 0, b.err
+}
+
+// BodyLimit returns a middleware limiting the size of the request bodies.
+// It could be used globally and as a route middleware to override the
+// global limit, the actions could also implement BodyLimiter. Reading a
+// larger body returns a BodyTooLargeError, which is written as 413 by
+// Return. A larger Content-Length is rejected with 413 right away, or fails
+// the first read if the route has middlewares which could raise the limit.
+func BodyLimit(opts ...BodyLimitOptions) HandlerFunc {
+	var opt BodyLimitOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.Limit == 0 {
+		opt.Limit = DefaultBodyLimit
+	}
+
+	return func(ctx *Context) {
+		limit := opt.Limit
+		if action := ctx.Action(); action != nil {
+			if l, ok := action.(BodyLimiter); ok {
+				limit = l.BodyLimit()
+			}
+		}
+
+		req := ctx.Req()
+		if req.Body == nil || req.Body == http.NoBody {
+			ctx.Next()
+			return
+		}
+
+		if limit >= 0 && req.ContentLength > limit &&
+			(ctx.stage != 0 || ctx.route == nil || len(ctx.route.handlers) == 0) {
+			ctx.Header().Set("Connection", "close")
+			ctx.Abort(http.StatusRequestEntityTooLarge, (&BodyTooLargeError{limit}).Error())
+			return
+		}
+
+		body := req.Body
+		if lb, ok := body.(*limitedBody); ok {
+			body = lb.orig
+		}
+		lb := &limitedBody{ReadCloser: body, orig: body, header: ctx.Header()}
+		if limit >= 0 && req.ContentLength > limit {
+			// fail without reading the body
+			lb.ReadCloser = errorBody{&http.MaxBytesError{Limit: limit}, body}
+		} else if limit >= 0 {
+			lb.ReadCloser = http.MaxBytesReader(ctx.ResponseWriter, body, limit)
+		}
+		if opt.ReadTimeout > 0 {
+			// the deadline is cleared once the whole body has been read,
+			// otherwise it would close the kept alive connection
+			rc := http.NewResponseController(ctx.ResponseWriter)
+			if rc.SetReadDeadline(time.Now().Add(opt.ReadTimeout)) == nil {
+				lb.done = func() {
+					rc.SetReadDeadline(time.Time{})
+				}
+			}
+		}
+		req.Body = lb
+		ctx.Next()
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tango
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type bodyLimitAction struct {
+	JSON
+	Ctx
+}
+
+func (a *bodyLimitAction) Post() interface{} {
+	var data map[string]string
+	if err := a.DecodeJSON(&data); err != nil {
+		return err
+	}
+	return data
+}
+
+type bodyLimitXMLAction struct {
+	XML
+	Ctx
+}
+
+func (a *bodyLimitXMLAction) Post() interface{} {
+	body, err := a.Body()
+	if err != nil {
+		return err
+	}
+	return body
+}
+
+type noBodyLimitAction struct {
+	bodyLimitAction
+}
+
+func (noBodyLimitAction) BodyLimit() int64 {
+	return -1
+}
+
+// chunkedBody hides the length of the body
+type chunkedBody struct {
+	io.Reader
+}
+
+func testBodyLimit(t *testing.T, o *Tango, url string, body io.Reader, code int, expected string) {
+	req, err := http.NewRequest("POST", "http://localhost:8000"+url, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	o.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, code)
+	expect(t, strings.TrimSpace(recorder.Body.String()), expected)
+}
+
+func TestBodyLimit(t *testing.T) {
+	o := Classic()
+	o.Use(BodyLimit(BodyLimitOptions{Limit: 20}))
+	o.Post("/", new(bodyLimitAction))
+	o.Post("/xml", new(bodyLimitXMLAction))
+	o.Post("/nolimit", new(noBodyLimitAction))
+	o.Post("/route", new(bodyLimitAction), BodyLimit(BodyLimitOptions{Limit: 100}))
+
+	small := `{"name":"lunny"}`
+	large := `{"name":"` + strings.Repeat("a", 50) + `"}`
+
+	testBodyLimit(t, o, "/", strings.NewReader(small), http.StatusOK, small)
+	// a larger Content-Length is rejected before the action
+	testBodyLimit(t, o, "/", strings.NewReader(large), http.StatusRequestEntityTooLarge,
+		"request body is larger than 20 bytes")
+	testBodyLimit(t, o, "/", chunkedBody{strings.NewReader(large)}, http.StatusRequestEntityTooLarge,
+		`{"err":"request body is larger than 20 bytes"}`)
+	testBodyLimit(t, o, "/xml", chunkedBody{strings.NewReader(large)}, http.StatusRequestEntityTooLarge,
+		`<err><content>request body is larger than 20 bytes</content></err>`)
+	testBodyLimit(t, o, "/nolimit", strings.NewReader(large), http.StatusOK, `{"name":"`+strings.Repeat("a", 50)+`"}`)
+	testBodyLimit(t, o, "/route", chunkedBody{strings.NewReader(large)}, http.StatusOK, `{"name":"`+strings.Repeat("a", 50)+`"}`)
+	testBodyLimit(t, o, "/route", strings.NewReader(large), http.StatusOK, `{"name":"`+strings.Repeat("a", 50)+`"}`)
+	testBodyLimit(t, o, "/route", strings.NewReader(strings.Repeat(large, 2)), http.StatusRequestEntityTooLarge,
+		"request body is larger than 100 bytes")
+}
+
+func TestBodyLimitForm(t *testing.T) {
+	o := Classic()
+	o.Use(BodyLimit(BodyLimitOptions{Limit: 10}))
+	o.Post("/", func(ctx *Context) string {
+		return ctx.Form("name")
+	})
+	o.Post("/forms", func(ctx *Context) interface{} {
+		name, err := ctx.Forms().String("name")
+		if err != nil {
+			return err
+		}
+		return name
+	}, HandlerFunc(func(ctx *Context) {
+		ctx.Next()
+	}))
+
+	body := "name=" + strings.Repeat("a", 20)
+	req, _ := http.NewRequest("POST", "http://localhost:8000/", strings.NewReader(body))
+	req.Header.Set(HeaderContentType, "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	o.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusRequestEntityTooLarge)
+
+	// the route middleware defers the limit to the first read
+	req, _ = http.NewRequest("POST", "http://localhost:8000/forms", strings.NewReader(body))
+	req.Header.Set(HeaderContentType, "application/x-www-form-urlencoded")
+	recorder = httptest.NewRecorder()
+	o.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusRequestEntityTooLarge)
+	expect(t, strings.TrimSpace(recorder.Body.String()), "request body is larger than 10 bytes")
+}
+
+func TestBodyLimitUpload(t *testing.T) {
+	o := Classic()
+	o.Use(BodyLimit(BodyLimitOptions{Limit: 100}))
+	o.Post("/upload", func(ctx *Context) error {
+		_, err := ctx.Upload()
+		return err
+	})
+
+	req := newUploadRequest(t, uploadPart{"file", "a.txt", []byte(strings.Repeat("a", 200))})
+	req.ContentLength = -1
+	req.Body = io.NopCloser(chunkedBody{req.Body})
+	recorder := httptest.NewRecorder()
+	o.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusRequestEntityTooLarge)
+}
+
+func TestBodyLimitReadTimeout(t *testing.T) {
+	o := Classic()
+	o.Use(BodyLimit(BodyLimitOptions{ReadTimeout: 100 * time.Millisecond}))
+	o.Post("/", func(ctx *Context) (int, string) {
+		body, err := ctx.Body()
+		if err != nil {
+			return http.StatusRequestTimeout, "timeout"
+		}
+		return http.StatusOK, string(body)
+	})
+	srv := httptest.NewServer(o)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+
+	// the deadline should not close the kept alive connection
+	fmt.Fprint(conn, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 2\r\n\r\nok")
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	expect(t, string(body), "ok")
+	time.Sleep(200 * time.Millisecond)
+
+	// the client sends the body too slowly
+	start := time.Now()
+	fmt.Fprint(conn, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 10\r\n\r\nok")
+	resp, err = http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, resp.StatusCode, http.StatusRequestTimeout)
+	expect(t, time.Since(start) < 5*time.Second, true)
+}
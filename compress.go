@@ -10,10 +10,13 @@ import (
 	"compress/gzip"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"path"
+	"strconv"
 	"strings"
+	"sync"
 )
 
 // some http headers
@@ -25,7 +28,8 @@ const (
 	HeaderVary            = "Vary"
 )
 
-// Compresser defines the interface return compress type
+// Compresser defines the interface return compress type, it's "auto" or
+// one of the registered encodings, see RegisterEncoder
 type Compresser interface {
 	CompressType() string
 }
@@ -46,6 +50,24 @@ func (Deflate) CompressType() string {
 	return "deflate"
 }
 
+// Brotli implements br Compresser, an encoder should be registered by
+// RegisterEncoder("br", ...)
+type Brotli struct{}
+
+// CompressType returns compress type
+func (Brotli) CompressType() string {
+	return "br"
+}
+
+// Zstd implements zstd Compresser, an encoder should be registered by
+// RegisterEncoder("zstd", ...)
+type Zstd struct{}
+
+// CompressType returns compress type
+func (Zstd) CompressType() string {
+	return "zstd"
+}
+
 // Compress implements auto Compresser
 type Compress struct{}
 
@@ -54,15 +76,71 @@ func (Compress) CompressType() string {
 	return "auto"
 }
 
-// Compresses defines a middleware to compress HTTP response
-func Compresses(exts []string) HandlerFunc {
+// DefaultCompressExcludedTypes are the content types which are already
+// compressed
+var DefaultCompressExcludedTypes = []string{
+	"image/png", "image/jpeg", "image/gif", "image/webp", "image/avif",
+	"video/*", "audio/*", "font/woff", "font/woff2",
+	"application/zip", "application/gzip", "application/x-gzip",
+	"application/x-bzip2", "application/x-7z-compressed", "application/x-rar-compressed",
+	"application/octet-stream",
+}
+
+// CompressOptions defines the options of Compresses
+type CompressOptions struct {
+	// Level is the compression level of gzip and deflate from
+	// gzip.HuffmanOnly to gzip.BestCompression, default is gzip.DefaultCompression
+	Level int
+	// Levels are the compression levels of the registered encoders, e.g.
+	// {"br": 5}, default is the default level of the encoder
+	Levels map[string]int
+	// MinSize is the minimum size of a compressed response, the response is
+	// buffered until MinSize bytes are written or it's flushed. Default is 0,
+	// all the responses are compressed.
+	MinSize int
+	// Types are the compressed content types, e.g. "text/*" or
+	// "application/json". Default is all the types not excluded.
+	Types []string
+	// ExcludedTypes are the content types never compressed, default is
+	// DefaultCompressExcludedTypes
+	ExcludedTypes []string
+}
+
+func prepareCompressOptions(opts []CompressOptions) *CompressOptions {
+	var opt CompressOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.Level == 0 || opt.Level < gzip.HuffmanOnly || opt.Level > gzip.BestCompression {
+		opt.Level = gzip.DefaultCompression
+	}
+	if opt.ExcludedTypes == nil {
+		opt.ExcludedTypes = DefaultCompressExcludedTypes
+	}
+	return &opt
+}
+
+// level returns the compression level of the encoding
+func (opt *CompressOptions) level(encoding string) int {
+	if encoding == "gzip" || encoding == "deflate" {
+		return opt.Level
+	}
+	return opt.Levels[encoding]
+}
+
+// Compresses defines a middleware to compress HTTP response, the files with
+// the extensions exts and the actions implementing Compresser are compressed
+// according to the Accept-Encoding of the request. The responses which have
+// a Content-Encoding, e.g. the precompressed static files, are not compressed.
+func Compresses(exts []string, opts ...CompressOptions) HandlerFunc {
 	extsmap := make(map[string]bool)
 	for _, ext := range exts {
 		extsmap[strings.ToLower(ext)] = true
 	}
+	opt := prepareCompressOptions(opts)
 
 	return func(ctx *Context) {
-		ae := ctx.Req().Header.Get("Accept-Encoding")
+		ae := ctx.Req().Header.Get(HeaderAcceptEncoding)
 		if ae == "" {
 			ctx.Next()
 			return
@@ -71,14 +149,14 @@ func Compresses(exts []string) HandlerFunc {
 		if len(extsmap) > 0 {
 			ext := strings.ToLower(path.Ext(ctx.Req().URL.Path))
 			if _, ok := extsmap[ext]; ok {
-				compress(ctx, "auto")
+				compress(ctx, "auto", opt)
 				return
 			}
 		}
 
 		if action := ctx.Action(); action != nil {
 			if c, ok := action.(Compresser); ok {
-				compress(ctx, c.CompressType())
+				compress(ctx, c.CompressType(), opt)
 				return
 			}
 		}
@@ -88,63 +166,330 @@ func Compresses(exts []string) HandlerFunc {
 	}
 }
 
-func compress(ctx *Context, compressType string) {
-	ae := ctx.Req().Header.Get("Accept-Encoding")
-	acceptCompress := strings.SplitN(ae, ",", -1)
-	var writer io.Writer
-	var val string
-
-	for _, val = range acceptCompress {
-		val = strings.TrimSpace(val)
-		if compressType == "auto" || val == compressType {
-			if val == "gzip" {
-				ctx.Header().Set("Content-Encoding", "gzip")
-				writer = gzip.NewWriter(ctx.ResponseWriter)
-				break
-			} else if val == "deflate" {
-				ctx.Header().Set("Content-Encoding", "deflate")
-				writer, _ = flate.NewWriter(ctx.ResponseWriter, flate.BestSpeed)
-				break
+// Encoder compresses a response with a content coding. If it implements
+// Reset(io.Writer) like gzip.Writer, it's pooled and reused.
+type Encoder interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// EncoderFunc creates an Encoder writing to w, level is the level set in
+// CompressOptions.Levels or 0 for the default level of the encoder
+type EncoderFunc func(w io.Writer, level int) (Encoder, error)
+
+type encoderResetter interface {
+	Reset(w io.Writer)
+}
+
+type encoderPoolKey struct {
+	encoding string
+	level    int
+}
+
+var (
+	encodersLock sync.RWMutex
+	encoders     = map[string]EncoderFunc{
+		"gzip": func(w io.Writer, level int) (Encoder, error) {
+			return gzip.NewWriterLevel(w, level)
+		},
+		"deflate": func(w io.Writer, level int) (Encoder, error) {
+			return flate.NewWriter(w, level)
+		},
+	}
+	// compressEncodings are the registered encodings in the order of preference
+	compressEncodings = []string{"gzip", "deflate"}
+	encoderPools      sync.Map
+)
+
+// RegisterEncoder registers an encoder of the content coding, e.g. "br" or
+// "zstd", so that it could be negotiated by Compresses and selected by the
+// action markers. The registered encoders are preferred to gzip and deflate
+// if the client accepts them with the same q-value.
+func RegisterEncoder(encoding string, fn EncoderFunc) {
+	encoding = strings.ToLower(encoding)
+	encodersLock.Lock()
+	defer encodersLock.Unlock()
+	if _, ok := encoders[encoding]; !ok {
+		compressEncodings = append([]string{encoding}, compressEncodings...)
+	}
+	encoders[encoding] = fn
+	dropEncoderPools(encoding)
+}
+
+// UnregisterEncoder removes the encoder of the content coding, it's not
+// negotiated any more
+func UnregisterEncoder(encoding string) {
+	encoding = strings.ToLower(encoding)
+	encodersLock.Lock()
+	defer encodersLock.Unlock()
+	if _, ok := encoders[encoding]; !ok {
+		return
+	}
+	delete(encoders, encoding)
+	for i, e := range compressEncodings {
+		if e == encoding {
+			compressEncodings = append(compressEncodings[:i:i], compressEncodings[i+1:]...)
+			break
+		}
+	}
+	dropEncoderPools(encoding)
+}
+
+// dropEncoderPools drops the pooled writers of the encoding
+func dropEncoderPools(encoding string) {
+	encoderPools.Range(func(k, v interface{}) bool {
+		if k.(encoderPoolKey).encoding == encoding {
+			encoderPools.Delete(k)
+		}
+		return true
+	})
+}
+
+// Encodings returns the registered content codings in the order of preference
+func Encodings() []string {
+	encodersLock.RLock()
+	defer encodersLock.RUnlock()
+	return append([]string{}, compressEncodings...)
+}
+
+// acceptEncoding returns the q-value of the encoding in the Accept-Encoding
+// header, it's -1 if the encoding is not listed
+func acceptEncoding(header, encoding string) float64 {
+	q, wildcard := -1.0, -1.0
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(params[0]))
+		if name != encoding && name != "*" && !(encoding == "gzip" && name == "x-gzip") {
+			continue
+		}
+		v := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if len(param) > 2 && (param[0] == 'q' || param[0] == 'Q') && param[1] == '=' {
+				if f, err := strconv.ParseFloat(param[2:], 64); err == nil && f >= 0 && f <= 1 {
+					v = f
+				} else {
+					v = 0
+				}
 			}
 		}
+		if name == "*" {
+			wildcard = v
+		} else {
+			q = v
+		}
+	}
+	if q < 0 {
+		return wildcard
+	}
+	return q
+}
+
+// negotiateEncoding returns the accepted encoding with the highest q-value,
+// compressType limits it to one encoding unless it's "auto"
+func negotiateEncoding(header, compressType string) string {
+	var best string
+	var bestQ float64
+	for _, encoding := range Encodings() {
+		if compressType != "auto" && compressType != encoding {
+			continue
+		}
+		if q := acceptEncoding(header, encoding); q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+func getEncoder(encoding string, w io.Writer, level int) (Encoder, error) {
+	if pool, ok := encoderPools.Load(encoderPoolKey{encoding, level}); ok {
+		if enc, ok := pool.(*sync.Pool).Get().(Encoder); ok {
+			enc.(encoderResetter).Reset(w)
+			return enc, nil
+		}
+	}
+
+	encodersLock.RLock()
+	fn := encoders[encoding]
+	encodersLock.RUnlock()
+	if fn == nil {
+		return nil, fmt.Errorf("tango: encoder %s is not registered", encoding)
 	}
+	return fn(w, level)
+}
+
+func putEncoder(encoding string, level int, enc Encoder) {
+	r, ok := enc.(encoderResetter)
+	if !ok {
+		return
+	}
+	// don't keep a reference to the response
+	r.Reset(ioutil.Discard)
+	pool, _ := encoderPools.LoadOrStore(encoderPoolKey{encoding, level}, &sync.Pool{})
+	pool.(*sync.Pool).Put(enc)
+}
+
+func compress(ctx *Context, compressType string, opt *CompressOptions) {
+	encoding := negotiateEncoding(ctx.Req().Header.Get(HeaderAcceptEncoding), compressType)
 
 	// not supported compress method, then ignore
-	if writer == nil {
+	if encoding == "" {
 		ctx.Next()
 		return
 	}
 
 	// for cache server
-	ctx.Header().Add(HeaderVary, "Accept-Encoding")
+	addVary(ctx.Header(), HeaderAcceptEncoding)
 
-	gzw := &compressWriter{writer, ctx.ResponseWriter}
+	gzw := &compressWriter{
+		ResponseWriter: ctx.ResponseWriter,
+		opt:            opt,
+		encoding:       encoding,
+	}
 	ctx.ResponseWriter = gzw
+	var finished bool
+	defer func() {
+		ctx.ResponseWriter = gzw.ResponseWriter
+		if !finished && !gzw.decided {
+			// panicking, drop the buffered response so that Recovery could write the error
+			gzw.buf = nil
+			gzw.status = 0
+		}
+		gzw.close()
+	}()
 
 	ctx.Next()
+	finished = true
+}
 
-	// delete content length after we know we have been written to
-	gzw.Header().Del(HeaderContentLength)
-	ctx.ResponseWriter = gzw.ResponseWriter
+// compressWriter buffers the beginning of the response, it decides to
+// compress the response once MinSize bytes are written, the response is
+// flushed or the headers show that it should not be compressed.
+type compressWriter struct {
+	ResponseWriter
+	opt      *CompressOptions
+	encoding string
 
-	switch writer.(type) {
-	case *gzip.Writer:
-		writer.(*gzip.Writer).Close()
-	case *flate.Writer:
-		writer.(*flate.Writer).Close()
+	status  int
+	buf     []byte
+	decided bool
+	// enc is nil if the response is not compressed
+	enc Encoder
+}
+
+// compressibleHeaders checks the status code and the headers
+func (grw *compressWriter) compressibleHeaders() bool {
+	switch {
+	case grw.status < http.StatusOK, grw.status == http.StatusNoContent,
+		grw.status == http.StatusPartialContent, grw.status == http.StatusNotModified:
+		return false
 	}
+	header := grw.Header()
+	return header.Get(HeaderContentEncoding) == "" && header.Get("Content-Range") == ""
 }
 
-type compressWriter struct {
-	w io.Writer
-	ResponseWriter
+// compressibleType checks the content type with the allow and deny lists
+func (grw *compressWriter) compressibleType() bool {
+	contentType := grw.Header().Get(HeaderContentType)
+	if !isAllowedType(contentType, grw.opt.Types) {
+		return false
+	}
+	return len(grw.opt.ExcludedTypes) == 0 || !isAllowedType(contentType, grw.opt.ExcludedTypes)
+}
+
+func (grw *compressWriter) shouldCompress() bool {
+	if len(grw.Header().Get(HeaderContentType)) == 0 && len(grw.buf) > 0 {
+		grw.Header().Set(HeaderContentType, http.DetectContentType(grw.buf))
+	}
+	return grw.compressibleHeaders() && grw.compressibleType()
+}
+
+// decide writes the status and the buffered data
+func (grw *compressWriter) decide(compress bool) {
+	grw.decided = true
+	if grw.status == 0 {
+		grw.status = http.StatusOK
+	}
+	if compress {
+		enc, err := getEncoder(grw.encoding, grw.ResponseWriter, grw.opt.level(grw.encoding))
+		if err == nil {
+			grw.Header().Set(HeaderContentEncoding, grw.encoding)
+			grw.Header().Del(HeaderContentLength)
+			grw.enc = enc
+		}
+	}
+	grw.ResponseWriter.WriteHeader(grw.status)
+
+	if len(grw.buf) > 0 {
+		grw.write(grw.buf)
+	}
+	grw.buf = nil
+}
+
+func (grw *compressWriter) write(p []byte) (int, error) {
+	if grw.enc != nil {
+		return grw.enc.Write(p)
+	}
+	return grw.ResponseWriter.Write(p)
+}
+
+func (grw *compressWriter) WriteHeader(status int) {
+	if grw.decided {
+		grw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if grw.status != 0 {
+		return
+	}
+	grw.status = status
+
+	// decide now if the response should not be compressed
+	cl, err := strconv.Atoi(grw.Header().Get(HeaderContentLength))
+	if (err == nil && cl < grw.opt.MinSize) || !grw.compressibleHeaders() ||
+		(len(grw.Header().Get(HeaderContentType)) > 0 && !grw.compressibleType()) {
+		grw.decide(false)
+	}
 }
 
 func (grw *compressWriter) Write(p []byte) (int, error) {
-	if len(grw.Header().Get(HeaderContentType)) == 0 {
-		grw.Header().Set(HeaderContentType, http.DetectContentType(p))
+	if grw.decided {
+		return grw.write(p)
+	}
+	if grw.status == 0 {
+		grw.WriteHeader(http.StatusOK)
+		if grw.decided {
+			return grw.write(p)
+		}
+	}
+
+	grw.buf = append(grw.buf, p...)
+	if len(grw.buf) >= grw.opt.MinSize {
+		grw.decide(grw.shouldCompress())
+	}
+	return len(p), nil
+}
+
+func (grw *compressWriter) Written() bool {
+	return grw.status != 0 || grw.ResponseWriter.Written()
+}
+
+func (grw *compressWriter) Status() int {
+	if !grw.decided && grw.status != 0 {
+		return grw.status
+	}
+	return grw.ResponseWriter.Status()
+}
+
+// close writes the buffered data and finishes the compressed stream
+func (grw *compressWriter) close() {
+	if !grw.decided && grw.status != 0 {
+		grw.decide(len(grw.buf) >= grw.opt.MinSize && grw.shouldCompress())
+	}
+	if grw.enc != nil {
+		grw.enc.Close()
+		putEncoder(grw.encoding, grw.opt.level(grw.encoding), grw.enc)
+		grw.enc = nil
 	}
-	return grw.w.Write(p)
 }
 
 func (grw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
@@ -154,3 +499,23 @@ func (grw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	}
 	return hijacker.Hijack()
 }
+
+// Unwrap returns the wrapped ResponseWriter for http.ResponseController
+func (grw *compressWriter) Unwrap() http.ResponseWriter {
+	return grw.ResponseWriter
+}
+
+// Flush flushes the compressed data to the client, the response is
+// compressed from now if it's not decided before
+func (grw *compressWriter) Flush() {
+	if !grw.decided {
+		if grw.status == 0 {
+			grw.status = http.StatusOK
+		}
+		grw.decide(grw.shouldCompress())
+	}
+	if grw.enc != nil {
+		grw.enc.Flush()
+	}
+	grw.ResponseWriter.Flush()
+}
@@ -9,9 +9,12 @@ import (
 	"compress/flate"
 	"compress/gzip"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -124,3 +127,191 @@ func testCompress(t *testing.T, o *Tango, url, content, enc string) {
 	}
 	expect(t, enc, ce)
 }
+
+func TestNegotiateEncoding(t *testing.T) {
+	expect(t, negotiateEncoding("gzip, deflate", "auto"), "gzip")
+	expect(t, negotiateEncoding("gzip;q=0, deflate", "auto"), "deflate")
+	expect(t, negotiateEncoding("gzip;q=0.5, deflate;q=0.8", "auto"), "deflate")
+	expect(t, negotiateEncoding("GZIP;Q=0.5, br", "auto"), "gzip")
+	expect(t, negotiateEncoding("x-gzip", "auto"), "gzip")
+	expect(t, negotiateEncoding("*", "auto"), "gzip")
+	expect(t, negotiateEncoding("*;q=0", "auto"), "")
+	expect(t, negotiateEncoding("gzip;q=0, *", "auto"), "deflate")
+	expect(t, negotiateEncoding("identity", "auto"), "")
+	expect(t, negotiateEncoding("gzip, deflate", "deflate"), "deflate")
+	expect(t, negotiateEncoding("gzip", "deflate"), "")
+}
+
+func testCompressRequest(t *testing.T, o *Tango, url, acceptEncoding string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest("GET", "http://localhost:8000"+url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(HeaderAcceptEncoding, acceptEncoding)
+	recorder := httptest.NewRecorder()
+	o.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func gunzip(t *testing.T, data []byte) string {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(bs)
+}
+
+func TestCompressOptions(t *testing.T) {
+	large := strings.Repeat("large text ", 20)
+	o := New(Compresses([]string{".txt", ".png", ".json"}, CompressOptions{
+		Level:   gzip.BestCompression,
+		MinSize: 100,
+		Types:   []string{"text/*", "image/*"},
+	}), Return(), Contexts())
+	o.Get("/small.txt", func() string {
+		return "small"
+	})
+	o.Get("/large.txt", func(ctx *Context) string {
+		ctx.Header().Set(HeaderContentLength, strconv.Itoa(len(large)))
+		return large
+	})
+	o.Get("/a.png", func() []byte {
+		return append([]byte("\x89PNG\x0D\x0A\x1A\x0A"), large...)
+	})
+	o.Get("/a.json", func(ctx *Context) string {
+		ctx.Header().Set(HeaderContentType, "application/json")
+		return large
+	})
+
+	recorder := testCompressRequest(t, o, "/small.txt", "gzip")
+	expect(t, recorder.Header().Get(HeaderContentEncoding), "")
+	expect(t, recorder.Header().Get(HeaderVary), HeaderAcceptEncoding)
+	expect(t, recorder.Body.String(), "small")
+
+	recorder = testCompressRequest(t, o, "/large.txt", "gzip;q=0.5, deflate;q=0")
+	expect(t, recorder.Header().Get(HeaderContentEncoding), "gzip")
+	expect(t, recorder.Header().Get(HeaderContentLength), "")
+	expect(t, gunzip(t, recorder.Body.Bytes()), large)
+
+	recorder = testCompressRequest(t, o, "/large.txt", "gzip;q=0")
+	expect(t, recorder.Header().Get(HeaderContentEncoding), "")
+	expect(t, recorder.Header().Get(HeaderContentLength), strconv.Itoa(len(large)))
+	expect(t, recorder.Body.String(), large)
+
+	// excluded by DefaultCompressExcludedTypes
+	recorder = testCompressRequest(t, o, "/a.png", "gzip")
+	expect(t, recorder.Header().Get(HeaderContentEncoding), "")
+	expect(t, recorder.Header().Get(HeaderContentType), "image/png")
+
+	// not in Types
+	recorder = testCompressRequest(t, o, "/a.json", "gzip")
+	expect(t, recorder.Header().Get(HeaderContentEncoding), "")
+	expect(t, recorder.Body.String(), large)
+}
+
+func TestCompressFlush(t *testing.T) {
+	o := New(Compresses([]string{".txt"}, CompressOptions{MinSize: 1000}), Return(), Contexts())
+	o.Get("/a.txt", func(ctx *Context) {
+		ctx.WriteString("first")
+		ctx.Flush()
+
+		// the flushed data could be decompressed before the end of the response
+		recorder := ctx.ResponseWriter.(*compressWriter).ResponseWriter.(*responseWriter).ResponseWriter.(*httptest.ResponseRecorder)
+		expect(t, recorder.Flushed, true)
+		r, err := gzip.NewReader(bytes.NewReader(recorder.Body.Bytes()))
+		expect(t, err, nil)
+		buf := make([]byte, 5)
+		_, err = io.ReadFull(r, buf)
+		expect(t, err, nil)
+		expect(t, string(buf), "first")
+
+		ctx.WriteString(" second")
+	})
+
+	recorder := testCompressRequest(t, o, "/a.txt", "gzip")
+	expect(t, recorder.Header().Get(HeaderContentEncoding), "gzip")
+	expect(t, gunzip(t, recorder.Body.Bytes()), "first second")
+}
+
+func TestCompressPanic(t *testing.T) {
+	o := New(Logging(), Recovery(false), Compresses([]string{".txt"}, CompressOptions{MinSize: 1000}), Return(), Contexts())
+	o.Get("/a.txt", func(ctx *Context) {
+		ctx.WriteString("partial")
+		panic("failed")
+	})
+
+	recorder := testCompressRequest(t, o, "/a.txt", "gzip")
+	expect(t, recorder.Code, http.StatusInternalServerError)
+	expect(t, recorder.Header().Get(HeaderContentEncoding), "")
+}
+
+// upperEncoder is a fake encoder uppering the content
+type upperEncoder struct {
+	w     io.Writer
+	level int
+}
+
+func (e *upperEncoder) Write(p []byte) (int, error) {
+	return e.w.Write(bytes.ToUpper(p))
+}
+
+func (e *upperEncoder) Flush() error {
+	return nil
+}
+
+func (e *upperEncoder) Close() error {
+	_, err := fmt.Fprintf(e.w, " (level %d)", e.level)
+	return err
+}
+
+func (e *upperEncoder) Reset(w io.Writer) {
+	e.w = w
+}
+
+type UpperCompress struct{}
+
+func (UpperCompress) CompressType() string {
+	return "x-upper"
+}
+
+type upperAction struct {
+	UpperCompress
+}
+
+func (upperAction) Get() string {
+	return "upper text"
+}
+
+func TestRegisterEncoder(t *testing.T) {
+	RegisterEncoder("X-Upper", func(w io.Writer, level int) (Encoder, error) {
+		return &upperEncoder{w, level}, nil
+	})
+	t.Cleanup(func() {
+		UnregisterEncoder("x-upper")
+		expect(t, strings.Join(Encodings(), ","), "gzip,deflate")
+		expect(t, negotiateEncoding("x-upper", "auto"), "")
+	})
+	expect(t, Encodings()[0], "x-upper")
+	expect(t, negotiateEncoding("gzip, x-upper", "auto"), "x-upper")
+	expect(t, negotiateEncoding("gzip, x-upper;q=0.5", "auto"), "gzip")
+
+	o := New(Compresses([]string{}, CompressOptions{Levels: map[string]int{"x-upper": 3}}), Return())
+	o.Get("/", new(upperAction))
+	o.Get("/gzip", new(GZipExample))
+
+	for i := 0; i < 2; i++ {
+		recorder := testCompressRequest(t, o, "/", "gzip, x-upper")
+		expect(t, recorder.Header().Get(HeaderContentEncoding), "x-upper")
+		expect(t, recorder.Body.String(), "UPPER TEXT (level 3)")
+	}
+
+	// the marker selects only its encoding
+	recorder := testCompressRequest(t, o, "/", "gzip")
+	expect(t, recorder.Header().Get(HeaderContentEncoding), "")
+	recorder = testCompressRequest(t, o, "/gzip", "x-upper, gzip;q=0.1")
+	expect(t, recorder.Header().Get(HeaderContentEncoding), "gzip")
+}
@@ -6,16 +6,18 @@ package tango
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"encoding/xml"
-	"fmt"
+	"errors"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
 	"reflect"
-	"strings"
+	"time"
 )
 
 // Handler defines middleware interface
@@ -39,6 +41,13 @@ type Context struct {
 
 	action interface{}
 	Result interface{}
+	data   map[string]interface{}
+
+	stream    *SSEStream
+	websocket *WebSocket
+	released  *releaseInfo
+	requestID string
+	logState  *requestLogState
 }
 
 func (ctx *Context) reset(req *http.Request, resp ResponseWriter) {
@@ -52,21 +61,133 @@ func (ctx *Context) reset(req *http.Request, resp ResponseWriter) {
 	ctx.matched = false
 	ctx.action = nil
 	ctx.Result = nil
+	ctx.data = nil
+	ctx.stream = nil
+	ctx.websocket = nil
+	ctx.requestID = ""
+	ctx.newRequestLogger()
 }
 
 // HandleError handles errors
 func (ctx *Context) HandleError() {
+	ctx.checkReleased()
 	ctx.tan.ErrHandler.Handle(ctx)
 }
 
 // Req returns current HTTP Request information
 func (ctx *Context) Req() *http.Request {
+	ctx.checkReleased()
 	return ctx.req
 }
 
 // SetRequest sets the request to context
 func (ctx *Context) SetRequest(req *http.Request) {
+	ctx.checkReleased()
 	ctx.req = req
+	ctx.logState.reset()
+	// keep the arguments of a matched function route in sync
+	if ctx.matched && ctx.route != nil && ctx.callArgs != nil {
+		switch ctx.route.routeType {
+		case FuncHTTPRoute:
+			ctx.callArgs[1] = reflect.ValueOf(req)
+		case FuncReqRoute:
+			ctx.callArgs[0] = reflect.ValueOf(req)
+		}
+	}
+}
+
+var _ context.Context = &Context{}
+
+// Deadline implements context.Context and returns the request's deadline
+func (ctx *Context) Deadline() (deadline time.Time, ok bool) {
+	return ctx.Req().Context().Deadline()
+}
+
+// Done implements context.Context, the returned channel is closed when
+// the client's connection closes or the request is canceled
+func (ctx *Context) Done() <-chan struct{} {
+	return ctx.Req().Context().Done()
+}
+
+// Err implements context.Context
+func (ctx *Context) Err() error {
+	return ctx.Req().Context().Err()
+}
+
+// Value implements context.Context and returns the value associated with
+// key in the request's context
+func (ctx *Context) Value(key interface{}) interface{} {
+	return ctx.Req().Context().Value(key)
+}
+
+// WithValue replaces the request with a copy whose context carries val for key
+func (ctx *Context) WithValue(key, val interface{}) {
+	ctx.SetRequest(ctx.req.WithContext(context.WithValue(ctx.req.Context(), key, val)))
+}
+
+// WithTimeout replaces the request with a copy whose context is canceled
+// after d. The returned cancel function should be called to release resources.
+func (ctx *Context) WithTimeout(d time.Duration) context.CancelFunc {
+	c, cancel := context.WithTimeout(ctx.req.Context(), d)
+	ctx.SetRequest(ctx.req.WithContext(c))
+	return cancel
+}
+
+// WithDeadline replaces the request with a copy whose context is canceled
+// at deadline. The returned cancel function should be called to release resources.
+func (ctx *Context) WithDeadline(deadline time.Time) context.CancelFunc {
+	c, cancel := context.WithDeadline(ctx.req.Context(), deadline)
+	ctx.SetRequest(ctx.req.WithContext(c))
+	return cancel
+}
+
+// ErrDetached is returned when writing to the response of a detached context
+var ErrDetached = errors.New("tango: response of a detached context is not writable")
+
+// stageDetached marks a detached context, its middleware chain is never invoked
+const stageDetached byte = 0xff
+
+// Detach returns a copy of the context which is safe to keep after the
+// request has finished, e.g. in a background goroutine. The copy keeps the
+// request, route, params, result and a copy of the data and of the log
+// fields but it is not canceled when the request ends, and its response cannot be written. The
+// action is not kept since it may embed the pooled context, so Action,
+// ActionValue and ActionTag must not be used on the copy. The request body
+// should not be read from a detached context.
+func (ctx *Context) Detach() *Context {
+	ctx.newAction()
+	req := ctx.req.Clone(context.WithoutCancel(ctx.req.Context()))
+	var data map[string]interface{}
+	if ctx.data != nil {
+		data = make(map[string]interface{}, len(ctx.data))
+		for k, v := range ctx.data {
+			data[k] = v
+		}
+	}
+	logState := ctx.logState.detach()
+	logger := ctx.Logger
+	if l, ok := logger.(*requestLogger); ok {
+		logger = &requestLogger{logState, l.base}
+	}
+	detached := &Context{
+		tan:       ctx.tan,
+		Logger:    logger,
+		req:       req,
+		route:     ctx.route,
+		params:    append(Params(nil), ctx.params...),
+		matched:   true,
+		stage:     stageDetached,
+		Result:    ctx.Result,
+		data:      data,
+		requestID: ctx.requestID,
+		logState:  logState,
+		ResponseWriter: &detachedResponseWriter{
+			header: ctx.Header().Clone(),
+			status: ctx.Status(),
+			size:   ctx.Size(),
+		},
+	}
+	return detached
 }
 
 // IsAjax returns if the request is an ajax request
@@ -82,6 +203,28 @@ func (ctx *Context) SecureCookies(secret string) Cookies {
 	}
 }
 
+// SetData stores a value of the request, the stored values are merged
+// into the data of the rendered templates
+func (ctx *Context) SetData(key string, value interface{}) {
+	ctx.checkReleased()
+	if ctx.data == nil {
+		ctx.data = make(map[string]interface{})
+	}
+	ctx.data[key] = value
+}
+
+// GetData returns a value stored by SetData
+func (ctx *Context) GetData(key string) interface{} {
+	ctx.checkReleased()
+	return ctx.data[key]
+}
+
+// Data returns all the values stored by SetData
+func (ctx *Context) Data() map[string]interface{} {
+	ctx.checkReleased()
+	return ctx.data
+}
+
 // Cookies returns the cookies
 func (ctx *Context) Cookies() Cookies {
 	return (*cookies)(ctx)
@@ -89,13 +232,14 @@ func (ctx *Context) Cookies() Cookies {
 
 // Forms returns the query/body names and values
 func (ctx *Context) Forms() *Forms {
-	ctx.req.ParseForm()
-	return (*Forms)(ctx.req)
+	req := ctx.Req()
+	req.ParseForm()
+	return (*Forms)(req)
 }
 
 // Queries returns the query names and values
 func (ctx *Context) Queries() *Queries {
-	return (*Queries)(ctx.req)
+	return (*Queries)(ctx.Req())
 }
 
 // Route returns route
@@ -110,24 +254,6 @@ func (ctx *Context) Params() *Params {
 	return &ctx.params
 }
 
-// IP returns remote IP
-func (ctx *Context) IP() string {
-	proxy := []string{}
-	if ips := ctx.Req().Header.Get("X-Forwarded-For"); ips != "" {
-		proxy = strings.Split(ips, ",")
-	}
-	if len(proxy) > 0 && proxy[0] != "" {
-		return proxy[0]
-	}
-	ip := strings.Split(ctx.Req().RemoteAddr, ":")
-	if len(ip) > 0 {
-		if ip[0] != "[" {
-			return ip[0]
-		}
-	}
-	return "127.0.0.1"
-}
-
 // Action returns action
 func (ctx *Context) Action() interface{} {
 	ctx.newAction()
@@ -164,6 +290,7 @@ func (ctx *Context) WriteString(content string) (int, error) {
 }
 
 func (ctx *Context) newAction() {
+	ctx.checkReleased()
 	if !ctx.matched {
 		reqPath := removeStick(ctx.Req().URL.Path)
 		ctx.route, ctx.params = ctx.tan.Match(reqPath, ctx.Req().Method)
@@ -197,6 +324,7 @@ func (ctx *Context) newAction() {
 // Next call next middleware or action
 // WARNING: don't invoke this method on action
 func (ctx *Context) Next() {
+	ctx.checkReleased()
 	ctx.idx++
 	ctx.invoke()
 }
@@ -228,11 +356,20 @@ func (ctx *Context) execute() {
 			ret = ctx.route.method.Call(ctx.callArgs)
 		}
 
+		// the action has returned, so nothing could be streamed any more
+		ctx.closeStreams()
+
 		if len(ret) == 1 {
 			ctx.Result = ret[0].Interface()
 		} else if len(ret) == 2 {
-			if code, ok := ret[0].Interface().(int); ok {
-				ctx.Result = &StatusResult{code, ret[1].Interface()}
+			switch first := ret[0].Interface().(type) {
+			case int:
+				ctx.Result = &StatusResult{first, ret[1].Interface()}
+			case string:
+				// (templateName, data) is only rendered for an HTML action
+				if rt, ok := ctx.action.(ResponseTyper); ok && rt.ResponseType() == htmlResponse {
+					ctx.Result = &TemplateResult{first, ret[1].Interface()}
+				}
 			}
 		}
 		// not route matched
@@ -243,7 +380,20 @@ func (ctx *Context) execute() {
 	}
 }
 
+// closeStreams closes the event stream and the websocket of the request
+func (ctx *Context) closeStreams() {
+	if ctx.stream != nil {
+		ctx.stream.Close()
+	}
+	if ctx.websocket != nil {
+		ctx.websocket.Close()
+	}
+}
+
 func (ctx *Context) invoke() {
+	if ctx.stage == stageDetached {
+		return
+	}
 	if ctx.stage == 0 {
 		if ctx.idx < len(ctx.tan.handlers) {
 			ctx.tan.handlers[ctx.idx].Handle(ctx)
@@ -276,8 +426,18 @@ func (ctx *Context) ServeFile(path string) error {
 	return ctx.ServeContent(file, http.Dir(dir))
 }
 
-// ServeContent serve content
+// ServeContent serve content, the files without modtime, e.g. the files
+// of an embed.FS, are served with an ETag of their content
 func (ctx *Context) ServeContent(path string, fileSystem http.FileSystem) error {
+	return ctx.serveContent(path, fileSystem, nil)
+}
+
+// ServeFS serves the file name of fsys, e.g. an embed.FS
+func (ctx *Context) ServeFS(fsys fs.FS, name string) error {
+	return ctx.ServeContent(name, FS(fsys))
+}
+
+func (ctx *Context) serveContent(path string, fileSystem http.FileSystem, etags *etagCache) error {
 	f, err := fileSystem.Open(path)
 	if err != nil {
 		msg, code := toHTTPError(err)
@@ -298,7 +458,7 @@ func (ctx *Context) ServeContent(path string, fileSystem http.FileSystem) error
 		return nil
 	}
 
-	http.ServeContent(ctx, ctx.Req(), d.Name(), d.ModTime(), f)
+	serveContent(ctx, etags, false, path, d, f)
 	return nil
 }
 
@@ -338,13 +498,14 @@ func (ctx *Context) ServeJSON(obj interface{}) error {
 
 // Body returns body's content
 func (ctx *Context) Body() ([]byte, error) {
+	ctx.checkReleased()
 	if ctx.req.Body == nil {
 		return []byte{}, nil
 	}
 
 	body, err := ioutil.ReadAll(ctx.req.Body)
 	if err != nil {
-		return nil, err
+		return nil, bodyError(err)
 	}
 
 	ctx.req.Body.Close()
@@ -359,14 +520,14 @@ func (ctx *Context) DecodeJson(obj interface{}) error {
 	return ctx.DecodeJSON(obj)
 }
 
-// DecodeJSON decodes body as JSON format to obj
+// DecodeJSON decodes body as JSON format to obj, the body is decoded as
+// it is read and could not be read again
 func (ctx *Context) DecodeJSON(obj interface{}) error {
-	body, err := ctx.Body()
-	if err != nil {
-		return err
+	ctx.checkReleased()
+	if ctx.req.Body == nil {
+		return io.EOF
 	}
-
-	return json.Unmarshal(body, obj)
+	return bodyError(json.NewDecoder(ctx.req.Body).Decode(obj))
 }
 
 // DecodeXml decodes body as XML format to obj
@@ -375,32 +536,21 @@ func (ctx *Context) DecodeXml(obj interface{}) error {
 	return ctx.DecodeXML(obj)
 }
 
-// DecodeXML decodes body as XML format to obj
+// DecodeXML decodes body as XML format to obj, the body is decoded as
+// it is read and could not be read again
 func (ctx *Context) DecodeXML(obj interface{}) error {
-	body, err := ctx.Body()
-	if err != nil {
-		return err
-	}
-
-	return xml.Unmarshal(body, obj)
-}
-
-// Download provides a locale file to http client
-func (ctx *Context) Download(fpath string) error {
-	f, err := os.Open(fpath)
-	if err != nil {
-		return err
+	ctx.checkReleased()
+	if ctx.req.Body == nil {
+		return io.EOF
 	}
-	defer f.Close()
-
-	fName := filepath.Base(fpath)
-	ctx.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%v\"", fName))
-	_, err = io.Copy(ctx, f)
-	return err
+	return bodyError(xml.NewDecoder(ctx.req.Body).Decode(obj))
 }
 
-// SaveToFile saves the HTTP post file form to local file path
+// SaveToFile saves the HTTP post file form to local file path, the
+// savePath should not be built from the client input. See Upload for
+// streaming the files with limits.
 func (ctx *Context) SaveToFile(formName, savePath string) error {
+	ctx.Req().ParseMultipartForm(MaxMultipartMemory)
 	file, _, err := ctx.Req().FormFile(formName)
 	if err != nil {
 		return err
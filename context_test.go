@@ -6,11 +6,13 @@ package tango
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 type CtxAction struct {
@@ -475,3 +477,115 @@ func TestContextActionTag(t *testing.T) {
 	expect(t, recorder.Code, http.StatusOK)
 	expect(t, buff.String(), "lunny")
 }
+
+type ctxValueKey struct{}
+
+func TestContextStdContext(t *testing.T) {
+	buff := bytes.NewBufferString("")
+	recorder := httptest.NewRecorder()
+	recorder.Body = buff
+
+	o := Classic()
+	o.Use(HandlerFunc(func(ctx *Context) {
+		ctx.WithValue(ctxValueKey{}, "lunny")
+		ctx.Next()
+	}))
+	o.Get("/", func(ctx *Context) string {
+		var c context.Context = ctx
+		if _, ok := c.Deadline(); ok {
+			return "unexpected deadline"
+		}
+		cancel := ctx.WithTimeout(time.Millisecond)
+		defer cancel()
+		if _, ok := c.Deadline(); !ok {
+			return "no deadline"
+		}
+		<-c.Done()
+		if c.Err() != context.DeadlineExceeded {
+			return "not canceled"
+		}
+		return c.Value(ctxValueKey{}).(string)
+	})
+
+	req, err := http.NewRequest("GET", "http://localhost:8000/", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	o.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, buff.String(), "lunny")
+}
+
+func TestContextWithValueHTTPFunc(t *testing.T) {
+	buff := bytes.NewBufferString("")
+	recorder := httptest.NewRecorder()
+	recorder.Body = buff
+
+	o := Classic()
+	o.Use(HandlerFunc(func(ctx *Context) {
+		ctx.Action()
+		ctx.WithValue(ctxValueKey{}, "lunny")
+		ctx.Next()
+	}))
+	o.Get("/", func(req *http.Request) string {
+		return req.Context().Value(ctxValueKey{}).(string)
+	})
+
+	req, err := http.NewRequest("GET", "http://localhost:8000/", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	o.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, buff.String(), "lunny")
+}
+
+func TestContextDetach(t *testing.T) {
+	buff := bytes.NewBufferString("")
+	recorder := httptest.NewRecorder()
+	recorder.Body = buff
+
+	var detached *Context
+	o := Classic()
+	o.Get("/:name", func(ctx *Context) string {
+		if detached == nil {
+			ctx.WithValue(ctxValueKey{}, "value")
+			ctx.SetData("name", "lunny")
+			detached = ctx.Detach()
+			ctx.SetData("name", "changed")
+		}
+		return "detach"
+	})
+
+	c, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequest("GET", "http://localhost:8000/lunny", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	req = req.WithContext(c)
+
+	o.ServeHTTP(recorder, req)
+	cancel()
+
+	// reuse the pooled context with another request
+	req, err = http.NewRequest("GET", "http://localhost:8000/other", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	o.ServeHTTP(httptest.NewRecorder(), req)
+
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, buff.String(), "detach")
+	expect(t, detached.Req().URL.Path, "/lunny")
+	expect(t, detached.Params().Get(":name"), "lunny")
+	expect(t, detached.Err(), nil)
+	expect(t, detached.Value(ctxValueKey{}), "value")
+	expect(t, detached.Data()["name"], "lunny")
+	expect(t, detached.Action(), nil)
+
+	_, err = detached.WriteString("late")
+	expect(t, err, ErrDetached)
+	expect(t, detached.Written(), true)
+}
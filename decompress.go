@@ -0,0 +1,162 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tango
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DecompressOptions defines the options of Decompress
+type DecompressOptions struct {
+	// MaxSize is the maximum size of a decompressed body, default is
+	// DefaultBodyLimit, a negative size means no limit
+	MaxSize int64
+}
+
+// decompressedBody reads the decompressed content and closes the original body
+type decompressedBody struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (b *decompressedBody) Close() error {
+	var err error
+	for i := len(b.closers) - 1; i >= 0; i-- {
+		if cerr := b.closers[i].Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// maxSizeReader fails when more than limit bytes are read, so that a
+// small compressed body could not be inflated without limit
+type maxSizeReader struct {
+	r     io.Reader
+	limit int64
+	n     int64
+}
+
+func (m *maxSizeReader) Read(p []byte) (int, error) {
+	if m.n > m.limit {
+		return 0, &http.MaxBytesError{Limit: m.limit}
+	}
+	if int64(len(p)) > m.limit-m.n+1 {
+		p = p[:m.limit-m.n+1]
+	}
+	n, err := m.r.Read(p)
+	m.n += int64(n)
+	if m.n > m.limit {
+		return n - int(m.n-m.limit), &http.MaxBytesError{Limit: m.limit}
+	}
+	return n, err
+}
+
+// deflateReader accepts both the zlib format required by the HTTP deflate
+// coding and the raw deflate sent by some clients
+func deflateReader(r io.Reader) (io.ReadCloser, error) {
+	br := newPeekReader(r)
+	head, _ := br.peek(2)
+	// the zlib header is a multiple of 31 with the deflate method
+	if len(head) == 2 && head[0]&0x0f == 8 && (uint16(head[0])<<8|uint16(head[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
+
+// peekReader reads the peeked bytes before the reader
+type peekReader struct {
+	r    io.Reader
+	head []byte
+}
+
+func newPeekReader(r io.Reader) *peekReader {
+	return &peekReader{r: r}
+}
+
+func (p *peekReader) peek(n int) ([]byte, error) {
+	p.head = make([]byte, n)
+	n, err := io.ReadFull(p.r, p.head)
+	p.head = p.head[:n]
+	return p.head, err
+}
+
+func (p *peekReader) Read(b []byte) (int, error) {
+	if len(p.head) > 0 {
+		n := copy(b, p.head)
+		p.head = p.head[n:]
+		return n, nil
+	}
+	return p.r.Read(b)
+}
+
+// Decompress returns a middleware decompressing the request bodies sent
+// with Content-Encoding gzip or deflate, so that Body, DecodeJSON and Forms
+// read the original content. Reading more than MaxSize decompressed bytes
+// returns a BodyTooLargeError, an unsupported encoding is rejected with 415.
+func Decompress(opts ...DecompressOptions) HandlerFunc {
+	var opt DecompressOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.MaxSize == 0 {
+		opt.MaxSize = DefaultBodyLimit
+	}
+
+	return func(ctx *Context) {
+		req := ctx.Req()
+		encoding := req.Header.Get(HeaderContentEncoding)
+		if encoding == "" || req.Body == nil || req.Body == http.NoBody {
+			ctx.Next()
+			return
+		}
+
+		body := &decompressedBody{Reader: req.Body, closers: []io.Closer{req.Body}}
+		codings := strings.Split(encoding, ",")
+		// the codings are listed in the order in which they were applied
+		for i := len(codings) - 1; i >= 0; i-- {
+			var r io.ReadCloser
+			var err error
+			switch strings.ToLower(strings.TrimSpace(codings[i])) {
+			case "", "identity":
+				continue
+			case "gzip", "x-gzip":
+				r, err = gzip.NewReader(body.Reader)
+			case "deflate":
+				r, err = deflateReader(body.Reader)
+			default:
+				body.Close()
+				ctx.Abort(http.StatusUnsupportedMediaType, "unsupported content encoding "+codings[i])
+				return
+			}
+			if err != nil {
+				body.Close()
+				status := http.StatusBadRequest
+				err = bodyError(err)
+				if tooLarge, ok := err.(*BodyTooLargeError); ok {
+					status = tooLarge.Code()
+				}
+				ctx.Abort(status, err.Error())
+				return
+			}
+			body.Reader = r
+			body.closers = append(body.closers, r)
+		}
+		if opt.MaxSize >= 0 {
+			body.Reader = &maxSizeReader{r: body.Reader, limit: opt.MaxSize}
+		}
+
+		req.Body = body
+		req.ContentLength = -1
+		req.Header.Del(HeaderContentEncoding)
+		req.Header.Del(HeaderContentLength)
+		ctx.Next()
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tango
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func gzipBytes(data []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+func zlibBytes(data []byte) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+func flateBytes(data []byte) []byte {
+	var buf bytes.Buffer
+	w, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+func testDecompress(t *testing.T, o *Tango, url, encoding string, body []byte, code int, expected string) {
+	req, err := http.NewRequest("POST", "http://localhost:8000"+url, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(HeaderContentEncoding, encoding)
+	if url == "/form" {
+		req.Header.Set(HeaderContentType, "application/x-www-form-urlencoded")
+	}
+	recorder := httptest.NewRecorder()
+	o.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, code)
+	expect(t, strings.TrimSpace(recorder.Body.String()), expected)
+}
+
+func TestDecompress(t *testing.T) {
+	o := Classic()
+	o.Use(Decompress(DecompressOptions{MaxSize: 1000}))
+	o.Post("/", new(bodyLimitAction))
+	o.Post("/form", func(ctx *Context) string {
+		return ctx.Forms().MustString("name")
+	})
+
+	data := []byte(`{"name":"lunny"}`)
+	testDecompress(t, o, "/", "gzip", gzipBytes(data), http.StatusOK, string(data))
+	testDecompress(t, o, "/", "deflate", zlibBytes(data), http.StatusOK, string(data))
+	testDecompress(t, o, "/", "deflate", flateBytes(data), http.StatusOK, string(data))
+	testDecompress(t, o, "/", "deflate, gzip", gzipBytes(zlibBytes(data)), http.StatusOK, string(data))
+	testDecompress(t, o, "/", "identity", data, http.StatusOK, string(data))
+	testDecompress(t, o, "/form", "GZIP", gzipBytes([]byte("name=lunny")), http.StatusOK, "lunny")
+
+	testDecompress(t, o, "/", "br", data, http.StatusUnsupportedMediaType,
+		"unsupported content encoding br")
+	testDecompress(t, o, "/", "gzip", data, http.StatusBadRequest, "gzip: invalid header")
+
+	// a decompression bomb
+	bomb := gzipBytes(bytes.Repeat([]byte(" "), 1<<20))
+	expect(t, len(bomb) < 5000, true)
+	testDecompress(t, o, "/", "gzip", bomb, http.StatusRequestEntityTooLarge,
+		`{"err":"request body is larger than 1000 bytes"}`)
+}
+
+func TestDecompressWithoutReturn(t *testing.T) {
+	o := New(Decompress())
+	o.Post("/", func(ctx *Context) {
+		ctx.Write([]byte("unreachable"))
+	})
+
+	testDecompress(t, o, "/", "br", []byte("data"), http.StatusUnsupportedMediaType,
+		"unsupported content encoding br")
+	testDecompress(t, o, "/", "gzip", []byte(`{"name":"lunny"}`), http.StatusBadRequest, "gzip: invalid header")
+}
+
+func TestDecompressBodyLimit(t *testing.T) {
+	o := New(BodyLimit(BodyLimitOptions{Limit: 5}), Decompress())
+	o.Post("/", func(ctx *Context) {
+		ctx.Write([]byte("unreachable"))
+	})
+
+	// the gzip header is already larger than the limit
+	req, _ := http.NewRequest("POST", "http://localhost:8000/", chunkedBody{bytes.NewReader(gzipBytes([]byte("data")))})
+	req.Header.Set(HeaderContentEncoding, "gzip")
+	recorder := httptest.NewRecorder()
+	o.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusRequestEntityTooLarge)
+	expect(t, strings.TrimSpace(recorder.Body.String()), "request body is larger than 5 bytes")
+}
+
+func TestMaxSizeReader(t *testing.T) {
+	r := &maxSizeReader{r: strings.NewReader(strings.Repeat("a", 10)), limit: 10}
+	data, err := io.ReadAll(r)
+	expect(t, err, nil)
+	expect(t, len(data), 10)
+
+	r = &maxSizeReader{r: strings.NewReader(strings.Repeat("a", 11)), limit: 10}
+	data, err = io.ReadAll(r)
+	expect(t, *bodyError(err).(*BodyTooLargeError), BodyTooLargeError{10})
+	expect(t, len(data), 10)
+}
@@ -0,0 +1,189 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tango
+
+import (
+	"encoding/json"
+	"html/template"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DirListEntry is a file of a directory listing
+type DirListEntry struct {
+	Name    string    `json:"name"`
+	URL     string    `json:"url"`
+	IsDir   bool      `json:"isDir"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	// Type is the MIME type by the file extension, or "directory"
+	Type string `json:"type"`
+}
+
+// DirList is the data of a directory listing
+type DirList struct {
+	// Path is the URL path of the directory
+	Path string `json:"path"`
+	// Parent is the URL of the parent directory, it's empty for the root
+	Parent  string         `json:"parent,omitempty"`
+	Entries []DirListEntry `json:"entries"`
+	// Sort is the sorting key, one of name, size, modtime and type
+	Sort string `json:"sort"`
+	// Order is asc or desc
+	Order string `json:"order"`
+}
+
+// SortURL returns the query to sort the listing by key, the order is
+// reversed if it's already sorted by key
+func (l *DirList) SortURL(key string) string {
+	order := "asc"
+	if l.Sort == key && l.Order == "asc" {
+		order = "desc"
+	}
+	return "?sort=" + key + "&order=" + order
+}
+
+// DefaultDirListTemplate is the default template of the directory listings
+var DefaultDirListTemplate = template.Must(template.New("dirlist").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Index of {{.Path}}</title></head>
+<body>
+<h1>Index of {{.Path}}</h1>
+<table>
+<tr><th><a href="{{.SortURL "name"}}">Name</a></th><th><a href="{{.SortURL "size"}}">Size</a></th><th><a href="{{.SortURL "modtime"}}">Modified</a></th><th><a href="{{.SortURL "type"}}">Type</a></th></tr>
+{{if .Parent}}<tr><td><a href="{{.Parent}}">..</a></td><td></td><td></td><td></td></tr>
+{{end}}{{range .Entries}}<tr><td><a href="{{.URL}}">{{.Name}}{{if .IsDir}}/{{end}}</a></td><td>{{if not .IsDir}}{{.Size}}{{end}}</td><td>{{.ModTime.UTC.Format "2006-01-02 15:04:05"}}</td><td>{{.Type}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// escapeURLPath percent-encodes the URL path p
+func escapeURLPath(p string) string {
+	return (&url.URL{Path: p}).EscapedPath()
+}
+
+// dirURLPath returns the URL path of the directory with a trailing slash
+func dirURLPath(elem ...string) string {
+	p := path.Join(elem...)
+	if !strings.HasSuffix(p, "/") {
+		p += "/"
+	}
+	return p
+}
+
+// newDirList returns the listing of the files of the directory rPath under
+// the URL prefix, sorted by the query parameters sort and order
+func newDirList(req *http.Request, prefix, rPath string, files []os.FileInfo, filter func(name string) bool) *DirList {
+	query := req.URL.Query()
+	rPath = path.Clean("/" + rPath)
+	dir := dirURLPath("/", prefix, rPath)
+	list := &DirList{
+		Path:    dir,
+		Entries: make([]DirListEntry, 0, len(files)),
+		Sort:    query.Get("sort"),
+		Order:   query.Get("order"),
+	}
+	if rPath != "/" {
+		list.Parent = escapeURLPath(dirURLPath("/", prefix, path.Dir(rPath)))
+	}
+
+	for _, fi := range files {
+		entry := DirListEntry{
+			Name:    fi.Name(),
+			IsDir:   fi.IsDir(),
+			Size:    fi.Size(),
+			ModTime: fi.ModTime(),
+		}
+		if fi.IsDir() {
+			entry.URL = escapeURLPath(dirURLPath(dir, fi.Name()))
+			entry.Type = "directory"
+		} else {
+			if filter != nil && !filter(fi.Name()) {
+				continue
+			}
+			entry.URL = escapeURLPath(path.Join(dir, fi.Name()))
+			entry.Type = mime.TypeByExtension(path.Ext(fi.Name()))
+		}
+		list.Entries = append(list.Entries, entry)
+	}
+
+	var less func(a, b *DirListEntry) bool
+	switch list.Sort {
+	case "size":
+		less = func(a, b *DirListEntry) bool { return a.Size < b.Size }
+	case "modtime":
+		less = func(a, b *DirListEntry) bool { return a.ModTime.Before(b.ModTime) }
+	case "type":
+		less = func(a, b *DirListEntry) bool { return a.Type < b.Type }
+	default:
+		list.Sort = "name"
+		less = func(a, b *DirListEntry) bool { return a.Name < b.Name }
+	}
+	if list.Order != "desc" {
+		list.Order = "asc"
+	}
+	sort.SliceStable(list.Entries, func(i, j int) bool {
+		a, b := &list.Entries[i], &list.Entries[j]
+		// the directories are always listed first
+		if a.IsDir != b.IsDir {
+			return a.IsDir
+		}
+		if list.Order == "desc" {
+			return less(b, a)
+		}
+		return less(a, b)
+	})
+	return list
+}
+
+// serveDirList writes the listing of the directory f as HTML, or as JSON
+// if the client accepts it
+func serveDirList(ctx *Context, opt *StaticOptions, rPath string, f http.File) {
+	files, err := f.Readdir(0)
+	if err != nil {
+		ctx.Result = InternalServerError(err.Error())
+		ctx.HandleError()
+		return
+	}
+
+	if opt.DotFiles != DotFilesAllow {
+		visible := files[:0]
+		for _, fi := range files {
+			if !strings.HasPrefix(fi.Name(), ".") {
+				visible = append(visible, fi)
+			}
+		}
+		files = visible
+	}
+
+	var filter func(string) bool
+	if len(opt.FilterExts) > 0 {
+		filter = opt.IsFilterExt
+	}
+	list := newDirList(ctx.Req(), opt.Prefix, rPath, files, filter)
+
+	addVary(ctx.Header(), "Accept")
+	if strings.Contains(ctx.Req().Header.Get("Accept"), "application/json") {
+		ctx.Header().Set(HeaderContentType, "application/json; charset=UTF-8")
+		json.NewEncoder(ctx).Encode(list)
+		return
+	}
+
+	tmpl := opt.ListTemplate
+	if tmpl == nil {
+		tmpl = DefaultDirListTemplate
+	}
+	ctx.Header().Set(HeaderContentType, "text/html; charset=UTF-8")
+	if err := tmpl.Execute(ctx, list); err != nil {
+		ctx.Error("list dir:", err)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tango
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStaticListDir(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "docs", "sub"), os.ModePerm)
+	files := map[string]string{
+		"docs/<b>x.txt":  "1",
+		"docs/big.css":   "1234567890",
+		"docs/a b#c.txt": "12345",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		os.WriteFile(p, []byte(content), 0644)
+	}
+	past := time.Now().Add(-time.Hour)
+	os.Chtimes(filepath.Join(dir, "docs", "big.css"), past, past)
+
+	o := New(Static(StaticOptions{RootPath: dir, Prefix: "/files", ListDir: true}))
+
+	recorder := testStaticRequest(t, o, "/files/docs")
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, recorder.Header().Get(HeaderContentType), "text/html; charset=UTF-8")
+	body := recorder.Body.String()
+	expect(t, strings.Contains(body, "<b>"), false)
+	expect(t, strings.Contains(body, "&lt;b&gt;x.txt"), true)
+	expect(t, strings.Contains(body, `href="/files/docs/a%20b%23c.txt"`), true)
+	expect(t, strings.Contains(body, `href="/files/"`), true)
+	expect(t, strings.Contains(body, `href="/files/docs/sub/"`), true)
+
+	var list DirList
+	recorder = testStaticRequest(t, o, "/files/docs?sort=size&order=desc", "Accept", "application/json")
+	expect(t, recorder.Header().Get(HeaderContentType), "application/json; charset=UTF-8")
+	expect(t, json.Unmarshal(recorder.Body.Bytes(), &list), nil)
+	expect(t, list.Path, "/files/docs/")
+	expect(t, list.Parent, "/files/")
+	names := make([]string, 0, len(list.Entries))
+	for _, entry := range list.Entries {
+		names = append(names, entry.Name)
+	}
+	expect(t, strings.Join(names, ","), "sub,big.css,a b#c.txt,<b>x.txt")
+	expect(t, list.Entries[0].Type, "directory")
+	expect(t, list.Entries[1].Size, int64(10))
+	expect(t, strings.HasPrefix(list.Entries[1].Type, "text/css"), true)
+
+	recorder = testStaticRequest(t, o, "/files/docs?sort=modtime", "Accept", "application/json")
+	expect(t, json.Unmarshal(recorder.Body.Bytes(), &list), nil)
+	expect(t, list.Entries[1].Name, "big.css")
+	expect(t, list.Order, "asc")
+
+	list = DirList{}
+	recorder = testStaticRequest(t, o, "/files/", "Accept", "application/json")
+	expect(t, json.Unmarshal(recorder.Body.Bytes(), &list), nil)
+	expect(t, list.Parent, "")
+}
+
+func TestStaticListTemplate(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644)
+
+	tmpl := template.Must(template.New("list").Parse(`{{range .Entries}}{{.Name}}:{{.Size}};{{end}}`))
+	o := New(Static(StaticOptions{RootPath: dir, ListDir: true, ListTemplate: tmpl, IndexFiles: []string{"none"}}))
+
+	recorder := testStaticRequest(t, o, "/")
+	expect(t, recorder.Body.String(), "a.txt:1;")
+}
@@ -0,0 +1,156 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tango
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HeaderContentDisposition is the header telling the browser to save or display the response
+const HeaderContentDisposition = "Content-Disposition"
+
+// DownloadOptions defines the options of the downloads
+type DownloadOptions struct {
+	// Filename is the file name shown to the user, default is the name of the file
+	Filename string
+	// Inline asks the browser to display the file instead of saving it
+	Inline bool
+}
+
+// ContentDisposition returns the Content-Disposition header value of the
+// file name, the non ASCII names are encoded in filename* (RFC 5987)
+// with an ASCII fallback for the old clients.
+func ContentDisposition(inline bool, filename string) string {
+	disposition := "attachment"
+	if inline {
+		disposition = "inline"
+	}
+	if filename == "" {
+		return disposition
+	}
+
+	var fallback strings.Builder
+	var ascii = true
+	for _, r := range filename {
+		switch {
+		case r >= 0x80:
+			ascii = false
+			fallback.WriteByte('_')
+		case r < 0x20 || r == 0x7f || r == '"' || r == '\\':
+			fallback.WriteByte('_')
+		default:
+			fallback.WriteRune(r)
+		}
+	}
+	v := disposition + `; filename="` + fallback.String() + `"`
+	if !ascii || fallback.String() != filename {
+		v += "; filename*=UTF-8''" + encodeRFC5987(filename)
+	}
+	return v
+}
+
+// encodeRFC5987 percent encodes all the bytes except the attr-chars of RFC 5987
+func encodeRFC5987(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') ||
+			strings.IndexByte("!#$&+-.^_`|~", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&15])
+	}
+	return b.String()
+}
+
+// Download sends a local file to the client, Range, If-Range and the
+// conditional requests are handled as http.ServeContent does.
+func (ctx *Context) Download(fpath string, opts ...DownloadOptions) error {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return ctx.DownloadFile(f, opts...)
+}
+
+// DownloadFile sends an opened file to the client, the name, the size and
+// the modification time are read from its Stat. Ranges are supported if the
+// file implements io.Seeker, e.g. the files of embed.FS or os.DirFS.
+func (ctx *Context) DownloadFile(f fs.File, opts ...DownloadOptions) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return errors.New("tango: " + info.Name() + " is a directory")
+	}
+
+	if rs, ok := f.(io.ReadSeeker); ok {
+		return ctx.DownloadContent(info.Name(), info.ModTime(), rs, opts...)
+	}
+
+	var opt DownloadOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	name := downloadName(info.Name(), opt)
+	ctx.setDownloadHeaders(name, opt)
+	if ctx.Header().Get(HeaderContentType) == "" {
+		ctype := mime.TypeByExtension(filepath.Ext(name))
+		if ctype == "" {
+			ctype = "application/octet-stream"
+		}
+		ctx.Header().Set(HeaderContentType, ctype)
+	}
+	if !info.ModTime().IsZero() {
+		ctx.Header().Set("Last-Modified", info.ModTime().UTC().Format(http.TimeFormat))
+	}
+	ctx.Header().Set(HeaderContentLength, strconv.FormatInt(info.Size(), 10))
+	ctx.WriteHeader(http.StatusOK)
+	if ctx.Req().Method == "HEAD" {
+		return nil
+	}
+	_, err = io.Copy(ctx, f)
+	return err
+}
+
+// DownloadContent sends content to the client as the file name, modtime is
+// used for Last-Modified and If-Range and could be zero.
+func (ctx *Context) DownloadContent(name string, modtime time.Time, content io.ReadSeeker, opts ...DownloadOptions) error {
+	var opt DownloadOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	name = downloadName(name, opt)
+	ctx.setDownloadHeaders(name, opt)
+	http.ServeContent(ctx, ctx.Req(), name, modtime, content)
+	return nil
+}
+
+func downloadName(name string, opt DownloadOptions) string {
+	if opt.Filename != "" {
+		return opt.Filename
+	}
+	return filepath.Base(name)
+}
+
+func (ctx *Context) setDownloadHeaders(name string, opt DownloadOptions) {
+	ctx.Header().Set(HeaderContentDisposition, ContentDisposition(opt.Inline, name))
+}
@@ -0,0 +1,142 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tango
+
+import (
+	"bytes"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestContentDisposition(t *testing.T) {
+	expect(t, ContentDisposition(false, "a.txt"), `attachment; filename="a.txt"`)
+	expect(t, ContentDisposition(true, "a.txt"), `inline; filename="a.txt"`)
+	expect(t, ContentDisposition(false, ""), `attachment`)
+	expect(t, ContentDisposition(false, `say "hi".txt`),
+		`attachment; filename="say _hi_.txt"; filename*=UTF-8''say%20%22hi%22.txt`)
+	expect(t, ContentDisposition(false, "报告 1.pdf"),
+		`attachment; filename="__ 1.pdf"; filename*=UTF-8''%E6%8A%A5%E5%91%8A%201.pdf`)
+}
+
+func TestDownloadRange(t *testing.T) {
+	o := Classic()
+	o.Get("/", func(ctx *Context) error {
+		return ctx.Download("./public/index.html", DownloadOptions{Filename: "首页.html"})
+	})
+
+	req, err := http.NewRequest("GET", "http://localhost:8000/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Range", "bytes=8-9")
+	recorder := httptest.NewRecorder()
+	o.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusPartialContent)
+	expect(t, recorder.Body.String(), "in")
+	expect(t, recorder.Header().Get("Content-Range"), "bytes 8-9/18")
+	expect(t, recorder.Header().Get(HeaderContentType), "text/html; charset=utf-8")
+	expect(t, recorder.Header().Get(HeaderContentDisposition),
+		`attachment; filename="__.html"; filename*=UTF-8''%E9%A6%96%E9%A1%B5.html`)
+	refute(t, recorder.Header().Get("Last-Modified"), "")
+
+	// the file has been modified since the client got it
+	req.Header.Set("If-Range", time.Unix(0, 0).UTC().Format(http.TimeFormat))
+	recorder = httptest.NewRecorder()
+	o.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, recorder.Body.String(), "this is index.html")
+	expect(t, recorder.Header().Get(HeaderContentLength), "18")
+}
+
+func TestDownloadContent(t *testing.T) {
+	modtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	o := Classic()
+	o.Get("/", func(ctx *Context) error {
+		return ctx.DownloadContent("report.csv", modtime, strings.NewReader("a,b\n1,2\n"), DownloadOptions{Inline: true})
+	})
+
+	req, err := http.NewRequest("GET", "http://localhost:8000/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	o.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, recorder.Body.String(), "a,b\n1,2\n")
+	expect(t, recorder.Header().Get(HeaderContentDisposition), `inline; filename="report.csv"`)
+	expect(t, recorder.Header().Get("Last-Modified"), modtime.Format(http.TimeFormat))
+
+	req.Header.Set("If-Modified-Since", modtime.Format(http.TimeFormat))
+	recorder = httptest.NewRecorder()
+	o.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusNotModified)
+}
+
+// noSeekFile hides the Seek method of a file
+type noSeekFile struct {
+	fs.File
+}
+
+func TestDownloadFile(t *testing.T) {
+	fsys := fstest.MapFS{
+		"dir/data.bin": &fstest.MapFile{Data: bytes.Repeat([]byte{1}, 100), ModTime: time.Unix(1000, 0)},
+	}
+	o := Classic()
+	o.Get("/seek", func(ctx *Context) error {
+		f, err := fsys.Open("dir/data.bin")
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return ctx.DownloadFile(f)
+	})
+	o.Get("/noseek", func(ctx *Context) error {
+		f, err := fsys.Open("dir/data.bin")
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return ctx.DownloadFile(noSeekFile{f})
+	})
+	o.Get("/dir", func(ctx *Context) error {
+		f, err := os.Open("./public")
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return ctx.DownloadFile(f)
+	})
+
+	req, err := http.NewRequest("GET", "http://localhost:8000/seek", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Range", "bytes=90-")
+	recorder := httptest.NewRecorder()
+	o.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusPartialContent)
+	expect(t, recorder.Body.Len(), 10)
+	expect(t, recorder.Header().Get(HeaderContentDisposition), `attachment; filename="data.bin"`)
+
+	req.URL.Path = "/noseek"
+	recorder = httptest.NewRecorder()
+	o.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, recorder.Body.Len(), 100)
+	expect(t, recorder.Header().Get(HeaderContentLength), "100")
+	expect(t, recorder.Header().Get(HeaderContentType), "application/octet-stream")
+	expect(t, recorder.Header().Get("Last-Modified"), time.Unix(1000, 0).UTC().Format(http.TimeFormat))
+
+	req.URL.Path = "/dir"
+	recorder = httptest.NewRecorder()
+	o.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusInternalServerError)
+}
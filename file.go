@@ -4,17 +4,41 @@
 
 package tango
 
-import "path/filepath"
+import (
+	"io/fs"
+	"net/http"
+	"path/filepath"
+)
 
-// File returns a handle to serve a file
-func File(path string) func(ctx *Context) {
+// serveError writes the error of the file system as ServeContent does
+func (ctx *Context) serveError(err error) {
+	msg, code := toHTTPError(err)
+	http.Error(ctx, msg, code)
+}
+
+// File returns a handle to serve a file, the dotfiles and the symbolic links
+// outside of its directory are refused by default
+func File(path string, opts ...FileOptions) func(ctx *Context) {
+	opt := prepareFileOptions(opts)
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	root := newRootDir(dir)
 	return func(ctx *Context) {
+		if err := opt.checkPath(ctx, root, name); err != nil {
+			ctx.serveError(err)
+			return
+		}
 		ctx.ServeFile(path)
 	}
 }
 
-// Dir returns a handle to serve a directory
-func Dir(dir string) func(ctx *Context) {
+// Dir returns a handle to serve a directory, the dotfiles, the paths with
+// ".." and the symbolic links outside of dir are refused by default
+func Dir(dir string, opts ...FileOptions) func(ctx *Context) {
+	opt := prepareFileOptions(opts)
+	root := newRootDir(dir)
 	return func(ctx *Context) {
 		params := ctx.Params()
 		if len(*params) <= 0 {
@@ -22,6 +46,44 @@ func Dir(dir string) func(ctx *Context) {
 			ctx.HandleError()
 			return
 		}
-		ctx.ServeFile(filepath.Join(dir, (*params)[0].Value))
+		name := (*params)[0].Value
+		if err := opt.checkPath(ctx, root, name); err != nil {
+			ctx.serveError(err)
+			return
+		}
+		ctx.ServeFile(filepath.Join(dir, filepath.FromSlash(name)))
+	}
+}
+
+// FileFS returns a handle to serve the file name of fsys, e.g. an embed.FS.
+// The ETags of the files without modtime are computed once.
+func FileFS(fsys fs.FS, name string) func(ctx *Context) {
+	fileSystem := FS(fsys)
+	etags := newETagCache()
+	return func(ctx *Context) {
+		ctx.serveContent(name, fileSystem, etags)
+	}
+}
+
+// DirFS returns a handle to serve the files of fsys, e.g. an embed.FS.
+// The ETags of the files without modtime are computed once. The dotfiles
+// and the paths with ".." are refused by default.
+func DirFS(fsys fs.FS, opts ...FileOptions) func(ctx *Context) {
+	opt := prepareFileOptions(opts)
+	fileSystem := FS(fsys)
+	etags := newETagCache()
+	return func(ctx *Context) {
+		params := ctx.Params()
+		if len(*params) <= 0 {
+			ctx.Result = NotFound()
+			ctx.HandleError()
+			return
+		}
+		name := (*params)[0].Value
+		if err := opt.checkPath(ctx, nil, name); err != nil {
+			ctx.serveError(err)
+			return
+		}
+		ctx.serveContent(name, fileSystem, etags)
 	}
 }
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestDir1(t *testing.T) {
@@ -87,3 +88,38 @@ func TestFile1(t *testing.T) {
 	refute(t, len(buff.String()), 0)
 	expect(t, buff.String(), "hello tango")
 }
+
+func TestFileFS(t *testing.T) {
+	tg := New()
+	tg.Get("/test.html", FileFS(testPublicSub(t), "test.html"))
+	tg.Get("/assets/*name", DirFS(testPublicSub(t)))
+	tg.Get("/ctx", func(ctx *Context) {
+		ctx.ServeFS(testPublicFS, "public/test.html")
+	})
+
+	recorder := testStaticRequest(t, tg, "/test.html")
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, recorder.Body.String(), "hello tango")
+	etag := recorder.Header().Get("ETag")
+	refute(t, etag, "")
+
+	recorder = testStaticRequest(t, tg, "/test.html", "If-None-Match", etag)
+	expect(t, recorder.Code, http.StatusNotModified)
+
+	recorder = testStaticRequest(t, tg, "/assets/js/my.js")
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, recorder.Body.String(), "var test")
+
+	recorder = testStaticRequest(t, tg, "/assets/js/../../static.go")
+	expect(t, recorder.Code, http.StatusForbidden)
+
+	recorder = testStaticRequest(t, tg, "/ctx", "If-None-Match", etag)
+	expect(t, recorder.Code, http.StatusNotModified)
+
+	mt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	f, err := ModTimeFS(testPublicFS, mt).Open("public/test.html")
+	expect(t, err, nil)
+	info, err := f.Stat()
+	expect(t, err, nil)
+	expect(t, info.ModTime(), mt)
+}
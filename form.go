@@ -22,15 +22,30 @@ func (f *Forms) Values() url.Values {
 	return (*http.Request)(f).Form
 }
 
+// formValue returns the first value of key, or the BodyTooLargeError if
+// the body is larger than the limit of BodyLimit
+func (f *Forms) formValue(key string) (string, error) {
+	req := (*http.Request)(f)
+	v := req.FormValue(key)
+	if err := bodyLimitError(req); err != nil {
+		return "", err
+	}
+	return v, nil
+}
+
 // String returns request form as string
 func (f *Forms) String(key string) (string, error) {
-	return (*http.Request)(f).FormValue(key), nil
+	return f.formValue(key)
 }
 
 // Strings returns request form as strings
 func (f *Forms) Strings(key string) ([]string, error) {
-	(*http.Request)(f).ParseMultipartForm(32 << 20)
-	if v, ok := (*http.Request)(f).Form[key]; ok {
+	req := (*http.Request)(f)
+	req.ParseMultipartForm(MaxMultipartMemory)
+	if err := bodyLimitError(req); err != nil {
+		return nil, err
+	}
+	if v, ok := req.Form[key]; ok {
 		return v, nil
 	}
 	return nil, errors.New("not exist")
@@ -38,56 +53,93 @@ func (f *Forms) Strings(key string) ([]string, error) {
 
 // Escape returns request form as escaped string
 func (f *Forms) Escape(key string) (string, error) {
-	return template.HTMLEscapeString((*http.Request)(f).FormValue(key)), nil
+	v, err := f.formValue(key)
+	return template.HTMLEscapeString(v), err
 }
 
 // Int returns request form as int
 func (f *Forms) Int(key string) (int, error) {
-	return strconv.Atoi((*http.Request)(f).FormValue(key))
+	v, err := f.formValue(key)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(v)
 }
 
 // Int32 returns request form as int32
 func (f *Forms) Int32(key string) (int32, error) {
-	v, err := strconv.ParseInt((*http.Request)(f).FormValue(key), 10, 32)
+	s, err := f.formValue(key)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseInt(s, 10, 32)
 	return int32(v), err
 }
 
 // Int64 returns request form as int64
 func (f *Forms) Int64(key string) (int64, error) {
-	return strconv.ParseInt((*http.Request)(f).FormValue(key), 10, 64)
+	v, err := f.formValue(key)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(v, 10, 64)
 }
 
 // Uint returns request form as uint
 func (f *Forms) Uint(key string) (uint, error) {
-	v, err := strconv.ParseUint((*http.Request)(f).FormValue(key), 10, 64)
+	s, err := f.formValue(key)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseUint(s, 10, 64)
 	return uint(v), err
 }
 
 // Uint32 returns request form as uint32
 func (f *Forms) Uint32(key string) (uint32, error) {
-	v, err := strconv.ParseUint((*http.Request)(f).FormValue(key), 10, 32)
+	s, err := f.formValue(key)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseUint(s, 10, 32)
 	return uint32(v), err
 }
 
 // Uint64 returns request form as uint64
 func (f *Forms) Uint64(key string) (uint64, error) {
-	return strconv.ParseUint((*http.Request)(f).FormValue(key), 10, 64)
+	v, err := f.formValue(key)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(v, 10, 64)
 }
 
 // Bool returns request form as bool
 func (f *Forms) Bool(key string) (bool, error) {
-	return strconv.ParseBool((*http.Request)(f).FormValue(key))
+	v, err := f.formValue(key)
+	if err != nil {
+		return false, err
+	}
+	return strconv.ParseBool(v)
 }
 
 // Float32 returns request form as float32
 func (f *Forms) Float32(key string) (float32, error) {
-	v, err := strconv.ParseFloat((*http.Request)(f).FormValue(key), 64)
+	s, err := f.formValue(key)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseFloat(s, 64)
 	return float32(v), err
 }
 
 // Float64 returns request form as float64
 func (f *Forms) Float64(key string) (float64, error) {
-	return strconv.ParseFloat((*http.Request)(f).FormValue(key), 64)
+	v, err := f.formValue(key)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(v, 64)
 }
 
 // MustString returns request form as string with default
@@ -103,7 +155,7 @@ func (f *Forms) MustString(key string, defaults ...string) string {
 
 // MustStrings returns request form as strings with default
 func (f *Forms) MustStrings(key string, defaults ...[]string) []string {
-	(*http.Request)(f).ParseMultipartForm(32 << 20)
+	(*http.Request)(f).ParseMultipartForm(MaxMultipartMemory)
 	if v, ok := (*http.Request)(f).Form[key]; ok {
 		return v
 	}
@@ -0,0 +1,129 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tango
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"time"
+)
+
+// FS converts fsys to an http.FileSystem, unlike http.FS the names are
+// cleaned as http.Dir does, e.g. "" and "a/../b" are valid
+func FS(fsys fs.FS) http.FileSystem {
+	return cleanFileSystem{http.FS(fsys)}
+}
+
+type cleanFileSystem struct {
+	http.FileSystem
+}
+
+func (c cleanFileSystem) Open(name string) (http.File, error) {
+	return c.FileSystem.Open(path.Clean("/" + name))
+}
+
+// ModTimeFS returns a file system reporting modTime as the modification time
+// of the files which have none, e.g. the files of an embed.FS, so that the
+// conditional requests with If-Modified-Since work. modTime is usually the
+// build time, which could be set by -ldflags.
+func ModTimeFS(fsys fs.FS, modTime time.Time) fs.FS {
+	return &modTimeFS{fsys, modTime}
+}
+
+type modTimeFS struct {
+	fsys    fs.FS
+	modTime time.Time
+}
+
+func (m *modTimeFS) Open(name string) (fs.File, error) {
+	f, err := m.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &modTimeFile{f, m.modTime}, nil
+}
+
+type modTimeFile struct {
+	fs.File
+	modTime time.Time
+}
+
+func (f *modTimeFile) Stat() (fs.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return withModTime(info, f.modTime), nil
+}
+
+// Seek implementes io.Seeker if the underlying file does, it's required by
+// http.ServeContent
+func (f *modTimeFile) Seek(offset int64, whence int) (int64, error) {
+	s, ok := f.File.(io.Seeker)
+	if !ok {
+		return 0, errors.New("tango: file is not seekable")
+	}
+	return s.Seek(offset, whence)
+}
+
+// ReadDir implementes fs.ReadDirFile if the underlying file does
+func (f *modTimeFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	d, ok := f.File.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Err: errors.New("not implemented")}
+	}
+	entries, err := d.ReadDir(n)
+	for i, entry := range entries {
+		entries[i] = &modTimeEntry{entry, f.modTime}
+	}
+	return entries, err
+}
+
+type modTimeEntry struct {
+	fs.DirEntry
+	modTime time.Time
+}
+
+func (e *modTimeEntry) Info() (fs.FileInfo, error) {
+	info, err := e.DirEntry.Info()
+	if err != nil {
+		return nil, err
+	}
+	return withModTime(info, e.modTime), nil
+}
+
+type modTimeInfo struct {
+	fs.FileInfo
+	modTime time.Time
+}
+
+func (i *modTimeInfo) ModTime() time.Time {
+	return i.modTime
+}
+
+func withModTime(info fs.FileInfo, modTime time.Time) fs.FileInfo {
+	if !info.ModTime().IsZero() {
+		return info
+	}
+	return &modTimeInfo{info, modTime}
+}
+
+// hashETag returns a strong ETag of the content of f, f is rewound after
+// being read
+func hashETag(f io.ReadSeeker) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`, nil
+}
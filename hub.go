@@ -0,0 +1,407 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tango
+
+import (
+	"errors"
+	"sync"
+	"unicode/utf8"
+)
+
+// Message is a message published to a topic
+type Message struct {
+	Topic string
+	// Event and ID are sent as the event name and id of Server-Sent Events
+	Event string
+	ID    string
+	Data  []byte
+}
+
+// Broker is the interface of a pub/sub backend, so that the messages could
+// be shared by the hubs of several processes, e.g. through redis or nats.
+type Broker interface {
+	// Publish sends the message to all the subscribers of its topic
+	Publish(msg Message) error
+	// Subscribe calls handler for every message published to topic until
+	// the returned cancel function is called. handler could be called from
+	// any goroutine but not before Subscribe returns.
+	Subscribe(topic string, handler func(Message)) (cancel func(), err error)
+}
+
+// memoryBroker is an in-process Broker
+type memoryBroker struct {
+	lock   sync.RWMutex
+	nextID int
+	topics map[string]map[int]func(Message)
+}
+
+// NewMemoryBroker returns an in-memory Broker
+func NewMemoryBroker() Broker {
+	return &memoryBroker{
+		topics: make(map[string]map[int]func(Message)),
+	}
+}
+
+func (b *memoryBroker) Publish(msg Message) error {
+	b.lock.RLock()
+	handlers := make([]func(Message), 0, len(b.topics[msg.Topic]))
+	for _, handler := range b.topics[msg.Topic] {
+		handlers = append(handlers, handler)
+	}
+	b.lock.RUnlock()
+
+	for _, handler := range handlers {
+		handler(msg)
+	}
+	return nil
+}
+
+func (b *memoryBroker) Subscribe(topic string, handler func(Message)) (func(), error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	id := b.nextID
+	b.nextID++
+	if b.topics[topic] == nil {
+		b.topics[topic] = make(map[int]func(Message))
+	}
+	b.topics[topic][id] = handler
+	return func() {
+		b.lock.Lock()
+		defer b.lock.Unlock()
+		delete(b.topics[topic], id)
+		if len(b.topics[topic]) == 0 {
+			delete(b.topics, topic)
+		}
+	}, nil
+}
+
+// SlowPolicy defines what to do when the buffer of a subscriber is full
+type SlowPolicy int
+
+// enumerate the slow subscriber policies
+const (
+	// DropMessage drops the messages which don't fit in the buffer
+	DropMessage SlowPolicy = iota
+	// DropSubscriber disconnects the slow subscriber
+	DropSubscriber
+)
+
+// HubOptions defines the options of a Hub
+type HubOptions struct {
+	// Broker is the pub/sub backend, default is NewMemoryBroker()
+	Broker Broker
+	// BufferSize is the number of messages buffered per subscriber, default is 16
+	BufferSize int
+	// SlowPolicy is applied when the buffer of a subscriber is full
+	SlowPolicy SlowPolicy
+}
+
+// ErrNoStream is returned when joining a hub without a stream
+var ErrNoStream = errors.New("tango: no event stream or websocket on the context")
+
+// Hub broadcasts the messages of topics to the Server-Sent Events and
+// websocket clients
+type Hub struct {
+	opt HubOptions
+
+	lock   sync.Mutex
+	topics map[string]*hubTopic
+	subs   map[*Subscriber]struct{}
+}
+
+type hubTopic struct {
+	subs   map[*Subscriber]struct{}
+	cancel func()
+}
+
+// NewHub creates a Hub
+func NewHub(opts ...HubOptions) *Hub {
+	var opt HubOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.Broker == nil {
+		opt.Broker = NewMemoryBroker()
+	}
+	if opt.BufferSize <= 0 {
+		opt.BufferSize = 16
+	}
+	return &Hub{
+		opt:    opt,
+		topics: make(map[string]*hubTopic),
+		subs:   make(map[*Subscriber]struct{}),
+	}
+}
+
+// Publish publishes the message to its topic
+func (h *Hub) Publish(msg Message) error {
+	return h.opt.Broker.Publish(msg)
+}
+
+// Broadcast publishes data to the topic
+func (h *Hub) Broadcast(topic string, data []byte) error {
+	return h.Publish(Message{Topic: topic, Data: data})
+}
+
+// Join subscribes the event stream or the websocket of ctx to the topics,
+// ctx.SSE or ctx.Upgrade should be called before. The subscriber leaves
+// the hub when the request ends or the client disconnects.
+func (h *Hub) Join(ctx *Context, topics ...string) (*Subscriber, error) {
+	var send func(Message) error
+	var closed <-chan struct{}
+	if ctx.stream != nil {
+		stream := ctx.stream
+		send = func(msg Message) error {
+			return stream.Send(msg.Event, msg.ID, msg.Data)
+		}
+		closed = stream.Done()
+	} else if ctx.websocket != nil {
+		ws := ctx.websocket
+		send = func(msg Message) error {
+			if utf8.Valid(msg.Data) {
+				return ws.WriteMessage(TextMessage, msg.Data)
+			}
+			return ws.WriteMessage(BinaryMessage, msg.Data)
+		}
+	} else {
+		return nil, ErrNoStream
+	}
+	return h.join(ctx, send, closed, topics)
+}
+
+// JoinFunc subscribes send to the topics, send is called by one goroutine
+// for every message. The subscriber leaves the hub when the request ends or
+// send returns an error.
+func (h *Hub) JoinFunc(ctx *Context, send func(Message) error, topics ...string) (*Subscriber, error) {
+	return h.join(ctx, send, nil, topics)
+}
+
+func (h *Hub) join(ctx *Context, send func(Message) error, closed <-chan struct{}, topics []string) (*Subscriber, error) {
+	sub := h.newSubscriber(send)
+	// leave the hub with the request
+	go func(reqDone <-chan struct{}) {
+		select {
+		case <-reqDone:
+		case <-closed:
+		case <-sub.done:
+		}
+		sub.Close()
+	}(ctx.Req().Context().Done())
+
+	if err := sub.Subscribe(topics...); err != nil {
+		sub.Close()
+		return nil, err
+	}
+	return sub, nil
+}
+
+func (h *Hub) newSubscriber(send func(Message) error) *Subscriber {
+	sub := &Subscriber{
+		hub:    h,
+		send:   send,
+		queue:  make(chan Message, h.opt.BufferSize),
+		topics: make(map[string]struct{}),
+		done:   make(chan struct{}),
+	}
+
+	h.lock.Lock()
+	h.subs[sub] = struct{}{}
+	h.lock.Unlock()
+
+	go sub.loop()
+	return sub
+}
+
+// deliver dispatches a message from the broker to the local subscribers
+func (h *Hub) deliver(msg Message) {
+	h.lock.Lock()
+	topic := h.topics[msg.Topic]
+	var subs []*Subscriber
+	if topic != nil {
+		subs = make([]*Subscriber, 0, len(topic.subs))
+		for sub := range topic.subs {
+			subs = append(subs, sub)
+		}
+	}
+	h.lock.Unlock()
+
+	for _, sub := range subs {
+		sub.enqueue(msg)
+	}
+}
+
+// Subscribers returns the number of the subscribers of the topic
+func (h *Hub) Subscribers(topic string) int {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if t, ok := h.topics[topic]; ok {
+		return len(t.subs)
+	}
+	return 0
+}
+
+// Close disconnects all the subscribers
+func (h *Hub) Close() {
+	h.lock.Lock()
+	subs := make([]*Subscriber, 0, len(h.subs))
+	for sub := range h.subs {
+		subs = append(subs, sub)
+	}
+	h.lock.Unlock()
+
+	for _, sub := range subs {
+		sub.Close()
+	}
+}
+
+// Subscriber is a connection joined to a Hub
+type Subscriber struct {
+	hub   *Hub
+	send  func(Message) error
+	queue chan Message
+
+	lock    sync.Mutex
+	topics  map[string]struct{}
+	closed  bool
+	done    chan struct{}
+	dropped int
+}
+
+// Subscribe adds the subscriber to the topics
+func (s *Subscriber) Subscribe(topics ...string) error {
+	h := s.hub
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return ErrStreamClosed
+	}
+
+	for _, topic := range topics {
+		if _, ok := s.topics[topic]; ok {
+			continue
+		}
+		t, ok := h.topics[topic]
+		if !ok {
+			t = &hubTopic{subs: make(map[*Subscriber]struct{})}
+			cancel, err := h.opt.Broker.Subscribe(topic, h.deliver)
+			if err != nil {
+				return err
+			}
+			t.cancel = cancel
+			h.topics[topic] = t
+		}
+		t.subs[s] = struct{}{}
+		s.topics[topic] = struct{}{}
+	}
+	return nil
+}
+
+// Unsubscribe removes the subscriber from the topics
+func (s *Subscriber) Unsubscribe(topics ...string) {
+	h := s.hub
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.unsubscribe(topics)
+}
+
+func (s *Subscriber) unsubscribe(topics []string) {
+	h := s.hub
+	for _, topic := range topics {
+		if _, ok := s.topics[topic]; !ok {
+			continue
+		}
+		delete(s.topics, topic)
+		if t, ok := h.topics[topic]; ok {
+			delete(t.subs, s)
+			if len(t.subs) == 0 {
+				delete(h.topics, topic)
+				t.cancel()
+			}
+		}
+	}
+}
+
+// Topics returns the subscribed topics
+func (s *Subscriber) Topics() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	topics := make([]string, 0, len(s.topics))
+	for topic := range s.topics {
+		topics = append(topics, topic)
+	}
+	return topics
+}
+
+// Dropped returns the number of the messages dropped because the
+// subscriber is slow
+func (s *Subscriber) Dropped() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.dropped
+}
+
+// Done returns a channel which is closed when the subscriber leaves the hub
+func (s *Subscriber) Done() <-chan struct{} {
+	return s.done
+}
+
+// Close makes the subscriber leave the hub
+func (s *Subscriber) Close() {
+	h := s.hub
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return
+	}
+
+	topics := make([]string, 0, len(s.topics))
+	for topic := range s.topics {
+		topics = append(topics, topic)
+	}
+	s.unsubscribe(topics)
+	delete(h.subs, s)
+	s.closed = true
+	close(s.done)
+}
+
+func (s *Subscriber) enqueue(msg Message) {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return
+	}
+	select {
+	case s.queue <- msg:
+		s.lock.Unlock()
+		return
+	default:
+	}
+	s.dropped++
+	s.lock.Unlock()
+
+	if s.hub.opt.SlowPolicy == DropSubscriber {
+		s.Close()
+	}
+}
+
+func (s *Subscriber) loop() {
+	for {
+		select {
+		case msg := <-s.queue:
+			if err := s.send(msg); err != nil {
+				s.Close()
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,242 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tango
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func waitSubscribers(t *testing.T, hub *Hub, topic string, n int) {
+	for i := 0; i < 500; i++ {
+		if hub.Subscribers(topic) == n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected %d subscribers of %s, got %d", n, topic, hub.Subscribers(topic))
+}
+
+func TestHubSSE(t *testing.T) {
+	hub := NewHub()
+	defer hub.Close()
+
+	o := New()
+	o.Get("/", func(ctx *Context) {
+		if _, err := ctx.SSE(); err != nil {
+			t.Error(err)
+			return
+		}
+		sub, err := hub.Join(ctx, "news")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		<-sub.Done()
+	})
+
+	srv := httptest.NewServer(o)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitSubscribers(t, hub, "news", 1)
+
+	hub.Publish(Message{Topic: "news", Event: "update", ID: "1", Data: []byte("hello")})
+	hub.Broadcast("other", []byte("ignored"))
+	reader := bufio.NewReader(resp.Body)
+	expect(t, readLine(t, reader), "id: 1")
+	expect(t, readLine(t, reader), "event: update")
+	expect(t, readLine(t, reader), "data: hello")
+
+	resp.Body.Close()
+	waitSubscribers(t, hub, "news", 0)
+}
+
+func TestHubWebSocket(t *testing.T) {
+	hub := NewHub()
+	defer hub.Close()
+
+	o := New()
+	o.Get("/", func(ctx *Context) {
+		ws, err := ctx.Upgrade()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		sub, err := hub.Join(ctx)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		for {
+			_, data, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			sub.Subscribe(string(data))
+			ws.WriteText("joined " + string(data))
+		}
+	})
+
+	srv := httptest.NewServer(o)
+	defer srv.Close()
+
+	c, _ := dialWebSocket(t, srv, "Sec-WebSocket-Version: 13\r\n")
+	c.writeFrame(t, true, TextMessage, []byte("chat"))
+	_, _, payload := c.readFrame(t)
+	expect(t, string(payload), "joined chat")
+
+	hub.Broadcast("chat", []byte("text"))
+	_, opcode, payload := c.readFrame(t)
+	expect(t, opcode, TextMessage)
+	expect(t, string(payload), "text")
+	hub.Broadcast("chat", []byte{0xff})
+	_, opcode, payload = c.readFrame(t)
+	expect(t, opcode, BinaryMessage)
+	expect(t, payload[0], byte(0xff))
+
+	c.writeFrame(t, true, CloseMessage, closeFrame(CloseNormalClosure, ""))
+	c.expectClose(t, CloseNormalClosure)
+	waitSubscribers(t, hub, "chat", 0)
+}
+
+func TestHubNoStream(t *testing.T) {
+	hub := NewHub()
+	var joinErr error
+	o := New()
+	o.Get("/", func(ctx *Context) {
+		_, joinErr = hub.Join(ctx, "news")
+	})
+
+	req, err := http.NewRequest("GET", "http://localhost:8000/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.ServeHTTP(httptest.NewRecorder(), req)
+	expect(t, joinErr, ErrNoStream)
+}
+
+func testSlowSubscriber(t *testing.T, policy SlowPolicy) (*Hub, *Subscriber, chan Message) {
+	hub := NewHub(HubOptions{BufferSize: 1, SlowPolicy: policy})
+	block := make(chan struct{})
+	taken := make(chan struct{}, 10)
+	received := make(chan Message, 10)
+	joined := make(chan *Subscriber)
+	finish := make(chan struct{})
+	served := make(chan struct{})
+
+	o := New()
+	o.Get("/", func(ctx *Context) {
+		sub, err := hub.JoinFunc(ctx, func(msg Message) error {
+			taken <- struct{}{}
+			<-block
+			received <- msg
+			return nil
+		}, "slow")
+		if err != nil {
+			t.Error(err)
+		}
+		joined <- sub
+		// the subscriber leaves the hub when the request ends
+		<-finish
+	})
+
+	req, err := http.NewRequest("GET", "http://localhost:8000/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		o.ServeHTTP(httptest.NewRecorder(), req)
+		close(served)
+	}()
+	t.Cleanup(func() {
+		close(finish)
+		<-served
+	})
+	sub := <-joined
+	expect(t, hub.Subscribers("slow"), 1)
+
+	// the first is taken by the send loop, the second is buffered
+	hub.Broadcast("slow", []byte("1"))
+	<-taken
+	hub.Broadcast("slow", []byte("2"))
+	hub.Broadcast("slow", []byte("3"))
+	close(block)
+	return hub, sub, received
+}
+
+func TestHubDropMessage(t *testing.T) {
+	hub, sub, received := testSlowSubscriber(t, DropMessage)
+	defer hub.Close()
+
+	expect(t, string((<-received).Data), "1")
+	expect(t, string((<-received).Data), "2")
+	expect(t, sub.Dropped(), 1)
+	expect(t, hub.Subscribers("slow"), 1)
+}
+
+func TestHubDropSubscriber(t *testing.T) {
+	hub, sub, _ := testSlowSubscriber(t, DropSubscriber)
+	defer hub.Close()
+
+	select {
+	case <-sub.Done():
+	case <-time.After(5 * time.Second):
+		t.Error("slow subscriber is not dropped")
+	}
+	expect(t, hub.Subscribers("slow"), 0)
+}
+
+type countBroker struct {
+	Broker
+	published int
+}
+
+func (b *countBroker) Publish(msg Message) error {
+	b.published++
+	return b.Broker.Publish(msg)
+}
+
+func TestHubBroker(t *testing.T) {
+	broker := &countBroker{Broker: NewMemoryBroker()}
+	hub := NewHub(HubOptions{Broker: broker})
+	defer hub.Close()
+
+	received := make(chan Message, 1)
+	o := New()
+	o.Get("/", func(ctx *Context) {
+		sub, err := hub.JoinFunc(ctx, func(msg Message) error {
+			received <- msg
+			return io.EOF
+		}, "a", "b")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		expect(t, len(sub.Topics()), 2)
+		sub.Unsubscribe("b")
+		expect(t, sub.Topics()[0], "a")
+	})
+
+	req, err := http.NewRequest("GET", "http://localhost:8000/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.ServeHTTP(httptest.NewRecorder(), req)
+
+	expect(t, hub.Subscribers("b"), 0)
+	broker.Publish(Message{Topic: "a", Data: []byte("from broker")})
+	expect(t, string((<-received).Data), "from broker")
+	expect(t, broker.published, 1)
+	// the failed send makes the subscriber leave
+	waitSubscribers(t, hub, "a", 0)
+}
@@ -5,7 +5,11 @@
 package tango
 
 import (
+	"fmt"
 	"io"
+	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"gitea.com/lunny/log"
@@ -23,6 +27,211 @@ type Logger interface {
 	Error(v ...interface{})
 }
 
+// LogLevel is the level of a structured log record
+type LogLevel int
+
+// the levels of the structured log records
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// String returns the name of the level
+func (l LogLevel) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return "LEVEL(" + strconv.Itoa(int(l)) + ")"
+}
+
+// FieldLogger defines the structured logger interface, the records have a
+// message and key/value fields, e.g. Log(LevelInfo, "done", "status", 200)
+type FieldLogger interface {
+	Logger
+	Log(level LogLevel, msg string, keyvals ...interface{})
+	// With returns a logger adding the key/value fields to every record
+	With(keyvals ...interface{}) FieldLogger
+}
+
+// ToFieldLogger returns l if it's a FieldLogger, or a bridge writing the
+// fields of the records as key=value through the methods of l
+func ToFieldLogger(l Logger) FieldLogger {
+	if fl, ok := l.(FieldLogger); ok {
+		return fl
+	}
+	return &fieldLogger{Logger: l}
+}
+
+// fieldLogger bridges a Logger to FieldLogger
+type fieldLogger struct {
+	Logger
+	fields []interface{}
+	// text is the formatted fields
+	text string
+}
+
+// With implementes FieldLogger
+func (l *fieldLogger) With(keyvals ...interface{}) FieldLogger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keyvals))
+	fields = append(append(fields, l.fields...), keyvals...)
+	return &fieldLogger{Logger: l.Logger, fields: fields, text: formatFields(fields)}
+}
+
+// Log implementes FieldLogger
+func (l *fieldLogger) Log(level LogLevel, msg string, keyvals ...interface{}) {
+	l.print(1, level, []interface{}{msg}, keyvals)
+}
+
+// outputLogger is a Logger reporting the file and line of the caller at
+// calldepth, e.g. the default logger
+type outputLogger interface {
+	Output(reqID string, level int, calldepth int, s string) error
+}
+
+// print passes the operands v and the fields to the Print method of the
+// level, so that the wrapped logger joins the operands as usual. calldepth
+// is the number of the frames between the caller to report and print.
+func (l *fieldLogger) print(calldepth int, level LogLevel, v []interface{}, keyvals []interface{}) {
+	text := l.text
+	if len(keyvals) > 0 {
+		text = appendText(text, formatFields(keyvals))
+	}
+	if text != "" {
+		if len(v) == 0 {
+			v = []interface{}{text}
+		} else {
+			v = append(v[:len(v)-1:len(v)-1], withText(v[len(v)-1], text))
+		}
+	}
+	if out, ok := l.Logger.(outputLogger); ok {
+		// the levels of the default logger are in the same order
+		out.Output("", int(level), calldepth+2, fmt.Sprintln(v...))
+		return
+	}
+	switch level {
+	case LevelDebug:
+		l.Logger.Debug(v...)
+	case LevelInfo:
+		l.Logger.Info(v...)
+	case LevelWarn:
+		l.Logger.Warn(v...)
+	default:
+		l.Logger.Error(v...)
+	}
+}
+
+// textOperand is a non-string operand followed by the fields, a string
+// operand would change how fmt.Sprint spaces it
+type textOperand struct {
+	v    interface{}
+	text string
+}
+
+func (o textOperand) String() string {
+	return appendText(fmt.Sprint(o.v), o.text)
+}
+
+// withText appends the fields text to the operand v
+func withText(v interface{}, text string) interface{} {
+	if s, ok := v.(string); ok {
+		return appendText(s, text)
+	}
+	return textOperand{v, text}
+}
+
+// Debugf implementes Logger interface
+func (l *fieldLogger) Debugf(format string, v ...interface{}) {
+	l.print(1, LevelDebug, []interface{}{fmt.Sprintf(format, v...)}, nil)
+}
+
+// Debug implementes Logger interface
+func (l *fieldLogger) Debug(v ...interface{}) {
+	l.print(1, LevelDebug, v, nil)
+}
+
+// Infof implementes Logger interface
+func (l *fieldLogger) Infof(format string, v ...interface{}) {
+	l.print(1, LevelInfo, []interface{}{fmt.Sprintf(format, v...)}, nil)
+}
+
+// Info implementes Logger interface
+func (l *fieldLogger) Info(v ...interface{}) {
+	l.print(1, LevelInfo, v, nil)
+}
+
+// Warnf implementes Logger interface
+func (l *fieldLogger) Warnf(format string, v ...interface{}) {
+	l.print(1, LevelWarn, []interface{}{fmt.Sprintf(format, v...)}, nil)
+}
+
+// Warn implementes Logger interface
+func (l *fieldLogger) Warn(v ...interface{}) {
+	l.print(1, LevelWarn, v, nil)
+}
+
+// Errorf implementes Logger interface
+func (l *fieldLogger) Errorf(format string, v ...interface{}) {
+	l.print(1, LevelError, []interface{}{fmt.Sprintf(format, v...)}, nil)
+}
+
+// Error implementes Logger interface
+func (l *fieldLogger) Error(v ...interface{}) {
+	l.print(1, LevelError, v, nil)
+}
+
+// sprint formats v as the message of a record, with the fmt.Sprint rules
+func sprint(v []interface{}) string {
+	return fmt.Sprint(v...)
+}
+
+func appendText(s, text string) string {
+	if text == "" {
+		return s
+	}
+	if s == "" {
+		return text
+	}
+	return s + " " + text
+}
+
+// formatFields formats the key/value pairs as key=value, the values with
+// spaces or quotes are quoted. A key without value is written as !BADKEY=key
+// as log/slog does.
+func formatFields(keyvals []interface{}) string {
+	var buf strings.Builder
+	for i := 0; i < len(keyvals); i += 2 {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		if i+1 == len(keyvals) {
+			buf.WriteString("!BADKEY=")
+			buf.WriteString(formatValue(keyvals[i]))
+			break
+		}
+		buf.WriteString(fmt.Sprint(keyvals[i]))
+		buf.WriteByte('=')
+		buf.WriteString(formatValue(keyvals[i+1]))
+	}
+	return buf.String()
+}
+
+func formatValue(v interface{}) string {
+	s := fmt.Sprint(v)
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
 // CompositeLogger defines a composite loggers
 type CompositeLogger struct {
 	loggers []Logger
@@ -89,6 +298,22 @@ func (l *CompositeLogger) Error(v ...interface{}) {
 	}
 }
 
+// Log implementes FieldLogger interface
+func (l *CompositeLogger) Log(level LogLevel, msg string, keyvals ...interface{}) {
+	for _, log := range l.loggers {
+		ToFieldLogger(log).Log(level, msg, keyvals...)
+	}
+}
+
+// With implementes FieldLogger interface
+func (l *CompositeLogger) With(keyvals ...interface{}) FieldLogger {
+	loggers := make([]Logger, len(l.loggers))
+	for i, log := range l.loggers {
+		loggers[i] = ToFieldLogger(log).With(keyvals...)
+	}
+	return &CompositeLogger{loggers: loggers}
+}
+
 // NewLogger use the default logger with special writer
 func NewLogger(out io.Writer) Logger {
 	l := log.New(out, "[tango] ", log.Ldefault())
@@ -111,16 +336,20 @@ func (l *Log) SetLogger(log Logger) {
 	l.Logger = log
 }
 
-// Logging returns handler to log informations
+// Logging returns handler to log informations, the records have the fields
+// of the request logger, e.g. method, path and ip, and the named fields
+// query, status and duration
 func Logging() HandlerFunc {
 	return func(ctx *Context) {
 		start := time.Now()
-		p := ctx.Req().URL.Path
+		var query []interface{}
 		if len(ctx.Req().URL.RawQuery) > 0 {
-			p = p + "?" + ctx.Req().URL.RawQuery
+			query = []interface{}{"query", ctx.Req().URL.RawQuery}
 		}
 
-		ctx.Debug("Started", ctx.Req().Method, p, "for", ctx.IP())
+		// ctx.Logger is read for every record, it could be replaced by the
+		// next middlewares
+		ToFieldLogger(ctx.Logger).Log(LevelDebug, "Started", query...)
 
 		if action := ctx.Action(); action != nil {
 			if l, ok := action.(LogInterface); ok {
@@ -138,11 +367,12 @@ func Logging() HandlerFunc {
 		}
 
 		statusCode := ctx.Status()
-
-		if statusCode >= 200 && statusCode < 400 {
-			ctx.Info(ctx.Req().Method, statusCode, time.Since(start), p)
+		fields := append(query, "status", statusCode, "duration", time.Since(start))
+		// a websocket upgrade is answered by 101 Switching Protocols
+		if statusCode >= 200 && statusCode < 400 || statusCode == http.StatusSwitchingProtocols {
+			ToFieldLogger(ctx.Logger).Log(LevelInfo, "Completed", fields...)
 		} else {
-			ctx.Error(ctx.Req().Method, statusCode, time.Since(start), p, ctx.Result)
+			ToFieldLogger(ctx.Logger).Log(LevelError, "Completed", append(fields, "error", ctx.Result)...)
 		}
 	}
 }
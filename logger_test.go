@@ -6,6 +6,9 @@ package tango
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -112,3 +115,94 @@ func TestLogger4(t *testing.T) {
 	n.ServeHTTP(recorder, req)
 	expect(t, recorder.Code, http.StatusOK)
 }
+
+func TestFieldLogger(t *testing.T) {
+	buff := bytes.NewBufferString("")
+	logger := ToFieldLogger(log.New(buff, "", log.Llevel))
+
+	child := logger.With("user", "lunny", "q", `a "b"`)
+	child.Log(LevelWarn, "login failed", "attempts", 3, "missing")
+	expect(t, buff.String(), `[Warn] login failed user=lunny q="a \"b\"" attempts=3 !BADKEY=missing`+"\n")
+
+	buff.Reset()
+	child.Infof("hello %s", "tango")
+	expect(t, buff.String(), "[Info] hello tango user=lunny q=\"a \\\"b\\\"\"\n")
+
+	buff.Reset()
+	logger.Error("a", 1)
+	expect(t, buff.String(), "[Error] a 1\n")
+
+	expect(t, ToFieldLogger(child), child)
+	expect(t, LevelError.String(), "ERROR")
+
+	// the operands are joined by the wrapped logger
+	var sprintLogger printLogger
+	ToFieldLogger(&sprintLogger).With("user", "lunny").Info("a", 1, 2)
+	expect(t, sprintLogger.String(), "a1 2 user=lunny")
+
+	sprintLogger.Reset()
+	ToFieldLogger(&sprintLogger).Log(LevelInfo, "login", "ok", true)
+	expect(t, sprintLogger.String(), "login ok=true")
+}
+
+// printLogger joins the operands with the fmt.Sprint rules like log.Print
+type printLogger struct {
+	bytes.Buffer
+}
+
+func (l *printLogger) Debugf(format string, v ...interface{}) { fmt.Fprintf(l, format, v...) }
+func (l *printLogger) Debug(v ...interface{})                 { fmt.Fprint(l, v...) }
+func (l *printLogger) Infof(format string, v ...interface{})  { fmt.Fprintf(l, format, v...) }
+func (l *printLogger) Info(v ...interface{})                  { fmt.Fprint(l, v...) }
+func (l *printLogger) Warnf(format string, v ...interface{})  { fmt.Fprintf(l, format, v...) }
+func (l *printLogger) Warn(v ...interface{})                  { fmt.Fprint(l, v...) }
+func (l *printLogger) Errorf(format string, v ...interface{}) { fmt.Fprintf(l, format, v...) }
+func (l *printLogger) Error(v ...interface{})                 { fmt.Fprint(l, v...) }
+
+func TestSlogLogger(t *testing.T) {
+	buff := bytes.NewBufferString("")
+	logger := NewSlogLogger(slog.New(slog.NewTextHandler(buff, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})))
+
+	logger.With("user", "lunny").Log(LevelInfo, "login", "ok", true)
+	expect(t, buff.String(), "level=INFO msg=login user=lunny ok=true\n")
+
+	buff.Reset()
+	logger.Debugf("hello %s", "tango")
+	expect(t, buff.String(), "level=DEBUG msg=\"hello tango\"\n")
+
+	buff.Reset()
+	composite := NewCompositeLogger(logger, log.New(bytes.NewBufferString(""), "", 0))
+	composite.(FieldLogger).With("a", 1).Log(LevelError, "failed")
+	expect(t, buff.String(), "level=ERROR msg=failed a=1\n")
+}
+
+func TestLoggingFields(t *testing.T) {
+	buff := bytes.NewBufferString("")
+	logger := NewSlogLogger(slog.New(slog.NewJSONHandler(buff, nil)))
+
+	o := NewWithLog(logger, Logging(), Return())
+	o.Get("/users", func() string {
+		return "users"
+	})
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:3000/users?id=1", nil)
+	o.ServeHTTP(recorder, req)
+
+	var record map[string]interface{}
+	expect(t, json.Unmarshal(buff.Bytes(), &record), nil)
+	expect(t, record["msg"], "Completed")
+	expect(t, record["method"], "GET")
+	expect(t, record["path"], "/users")
+	expect(t, record["query"], "id=1")
+	expect(t, record["route"], "/users")
+	expect(t, record["status"], float64(200))
+	refute(t, record["duration"], nil)
+}
@@ -0,0 +1,127 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tango
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Manifest maps the asset names to their fingerprinted names, e.g. "app.js"
+// to "app.3f9a1c.js", so that the templates could link to the files which
+// are served as immutable. It's safe for concurrent use.
+type Manifest struct {
+	lock   sync.RWMutex
+	assets map[string]string
+	// names maps the fingerprinted names back to the asset names
+	names map[string]string
+}
+
+// NewManifest creates a Manifest from the assets map
+func NewManifest(assets map[string]string) *Manifest {
+	m := &Manifest{
+		assets: make(map[string]string, len(assets)),
+		names:  make(map[string]string, len(assets)),
+	}
+	for k, v := range assets {
+		m.set(k, v)
+	}
+	return m
+}
+
+// set should be called with the lock held
+func (m *Manifest) set(name, fingerprinted string) {
+	name = strings.TrimPrefix(name, "/")
+	fingerprinted = strings.TrimPrefix(fingerprinted, "/")
+	if old, ok := m.assets[name]; ok && m.names[old] == name {
+		delete(m.names, old)
+	}
+	m.assets[name] = fingerprinted
+	m.names[fingerprinted] = name
+}
+
+// LoadManifest reads a JSON manifest file written by the build pipeline,
+// e.g. {"app.js": "app.3f9a1c.js"}
+func LoadManifest(file string) (*Manifest, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var assets map[string]string
+	if err = json.Unmarshal(data, &assets); err != nil {
+		return nil, err
+	}
+	return NewManifest(assets), nil
+}
+
+// ScanManifest builds a Manifest from the fingerprinted files in the
+// directory, e.g. js/app.3f9a1c.js is mapped from js/app.js. The most
+// recently modified file wins if there are several versions.
+func ScanManifest(dir string) (*Manifest, error) {
+	assets := make(map[string]string)
+	modTimes := make(map[string]int64)
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		base, ok := removeFingerprint(info.Name())
+		if !ok {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		name := path.Join(path.Dir(rel), base)
+		if modTime := info.ModTime().UnixNano(); modTime >= modTimes[name] {
+			assets[name] = rel
+			modTimes[name] = modTime
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return NewManifest(assets), nil
+}
+
+// Lookup returns the fingerprinted name of the asset, or name itself if
+// it's not in the manifest
+func (m *Manifest) Lookup(name string) string {
+	key := strings.TrimPrefix(name, "/")
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	if v, ok := m.assets[key]; ok {
+		if strings.HasPrefix(name, "/") {
+			return "/" + v
+		}
+		return v
+	}
+	return name
+}
+
+// Set adds or replaces an asset of the manifest
+func (m *Manifest) Set(name, fingerprinted string) {
+	m.lock.Lock()
+	m.set(name, fingerprinted)
+	m.lock.Unlock()
+}
+
+// IsFingerprinted returns true if name is a fingerprinted name of the
+// manifest
+func (m *Manifest) IsFingerprinted(name string) bool {
+	m.lock.RLock()
+	_, ok := m.names[strings.TrimPrefix(name, "/")]
+	m.lock.RUnlock()
+	return ok
+}
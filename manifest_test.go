@@ -0,0 +1,64 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tango
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestManifest(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "manifest.json")
+	os.WriteFile(p, []byte(`{"app.js": "app.3f9a1c.js", "/css/a.css": "/css/a.0123456.css"}`), 0644)
+
+	m, err := LoadManifest(p)
+	expect(t, err, nil)
+	expect(t, m.Lookup("app.js"), "app.3f9a1c.js")
+	expect(t, m.Lookup("/app.js"), "/app.3f9a1c.js")
+	expect(t, m.Lookup("css/a.css"), "css/a.0123456.css")
+	expect(t, m.Lookup("none.js"), "none.js")
+
+	m.Set("none.js", "none.abcdef.js")
+	expect(t, m.Lookup("none.js"), "none.abcdef.js")
+
+	_, err = LoadManifest(filepath.Join(dir, "none.json"))
+	refute(t, err, nil)
+}
+
+func TestScanManifest(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplates(t, dir, map[string]string{
+		"js/app.3f9a1c.js":        "old",
+		"js/app.4e8b2d.js":        "new",
+		"js/vendor.abcdef.min.js": "",
+		"js/plain.js":             "",
+	})
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(filepath.Join(dir, "js/app.3f9a1c.js"), old, old)
+
+	m, err := ScanManifest(dir)
+	expect(t, err, nil)
+	expect(t, m.Lookup("js/app.js"), "js/app.4e8b2d.js")
+	expect(t, m.Lookup("js/vendor.min.js"), "js/vendor.abcdef.min.js")
+	expect(t, m.Lookup("js/plain.js"), "js/plain.js")
+}
+
+func TestRenderManifest(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplates(t, dir, map[string]string{
+		"home.html": `<script src="{{Asset "js/app.js"}}"></script>`,
+	})
+	o := newRenderTango(t, RendererOptions{
+		Directory: dir,
+		Manifest:  NewManifest(map[string]string{"js/app.js": "js/app.3f9a1c.js"}),
+	})
+	o.Get("/", func() interface{} {
+		return Render("home", nil)
+	})
+	testRender(t, o, "http://localhost:8000/", 200, `<script src="/public/js/app.3f9a1c.js"></script>`)
+}
@@ -0,0 +1,123 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tango
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// DotFiles defines how the files and the directories whose names begin
+// with a dot, e.g. .env or .git/config, are served
+type DotFiles int
+
+const (
+	// DotFilesIgnore serves the dotfiles as if they don't exist, it's the default
+	DotFilesIgnore DotFiles = iota
+	// DotFilesDeny responds 403 Forbidden for the dotfiles
+	DotFilesDeny
+	// DotFilesAllow serves the dotfiles
+	DotFilesAllow
+)
+
+// FileOptions defines the options of File, Dir and DirFS
+type FileOptions struct {
+	DotFiles DotFiles
+	// FollowSymlinks serves the symbolic links pointing outside of the root
+	// directory, they are refused by default
+	FollowSymlinks bool
+}
+
+func prepareFileOptions(opts []FileOptions) FileOptions {
+	if len(opts) > 0 {
+		return opts[0]
+	}
+	return FileOptions{}
+}
+
+// hasDotDot returns true if the slash or backslash separated name has a ".."
+// element
+func hasDotDot(name string) bool {
+	if !strings.Contains(name, "..") {
+		return false
+	}
+	for _, elem := range strings.FieldsFunc(name, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if elem == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// hasDotFile returns true if an element of the slash-separated name begins
+// with a dot
+func hasDotFile(name string) bool {
+	for _, elem := range strings.Split(name, "/") {
+		if len(elem) > 1 && elem[0] == '.' && elem != ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// rootDir is the directory whose symbolic links are checked, its own links
+// are resolved once
+type rootDir struct {
+	dir  string
+	real string
+}
+
+func newRootDir(dir string) *rootDir {
+	// a missing directory is resolved again when it's checked
+	real, _ := filepath.EvalSymlinks(dir)
+	return &rootDir{dir, real}
+}
+
+// escapes returns true if the file name, relative to the root directory,
+// is a symbolic link or in a linked directory pointing outside of root
+func (r *rootDir) escapes(name string) bool {
+	realRoot := r.real
+	if realRoot == "" {
+		var err error
+		if realRoot, err = filepath.EvalSymlinks(r.dir); err != nil {
+			return false
+		}
+	}
+	target, err := filepath.EvalSymlinks(filepath.Join(r.dir, filepath.FromSlash(name)))
+	if err != nil {
+		// the missing files are handled by the file system
+		return false
+	}
+	rel, err := filepath.Rel(realRoot, target)
+	return err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// checkPath returns os.ErrNotExist or os.ErrPermission if the request of
+// the slash-separated name violates the policy, the violations are logged
+// with the client IP. The symbolic links are only checked if root, the
+// directory of the files, is not nil.
+func (opt FileOptions) checkPath(ctx *Context, root *rootDir, name string) error {
+	if hasDotDot(name) {
+		ctx.Warnf("path traversal %q is refused for %s", name, ctx.IP())
+		return os.ErrPermission
+	}
+
+	name = path.Clean("/" + name)
+	if opt.DotFiles != DotFilesAllow && hasDotFile(name) {
+		ctx.Warnf("dotfile %q is refused for %s", name, ctx.IP())
+		if opt.DotFiles == DotFilesDeny {
+			return os.ErrPermission
+		}
+		return os.ErrNotExist
+	}
+
+	if !opt.FollowSymlinks && root != nil && root.escapes(name) {
+		ctx.Warnf("symlink %q outside of the root is refused for %s", name, ctx.IP())
+		return os.ErrPermission
+	}
+	return nil
+}
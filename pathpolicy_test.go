@@ -0,0 +1,139 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tango
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files ...string) {
+	for _, name := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestStaticDotFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, ".env", ".git/config", "a.txt")
+
+	o := New(Static(StaticOptions{RootPath: dir, Prefix: "/s", ListDir: true}))
+	for _, url := range []string{"/s/.env", "/s/.git/config"} {
+		recorder := testStaticRequest(t, o, url)
+		expect(t, recorder.Code, http.StatusNotFound)
+	}
+
+	var list DirList
+	recorder := testStaticRequest(t, o, "/s/", "Accept", "application/json")
+	expect(t, json.Unmarshal(recorder.Body.Bytes(), &list), nil)
+	expect(t, len(list.Entries), 1)
+	expect(t, list.Entries[0].Name, "a.txt")
+
+	o = New(Static(StaticOptions{RootPath: dir, Prefix: "/s", DotFiles: DotFilesDeny}))
+	recorder = testStaticRequest(t, o, "/s/.git/config")
+	expect(t, recorder.Code, http.StatusForbidden)
+
+	o = New(Static(StaticOptions{RootPath: dir, Prefix: "/s", DotFiles: DotFilesAllow}))
+	recorder = testStaticRequest(t, o, "/s/.env")
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, recorder.Body.String(), ".env")
+}
+
+func TestStaticSymlinks(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	writeFiles(t, root, "a.txt")
+	writeFiles(t, outside, "secret.txt")
+	if err := os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(root, "secret.txt")); err != nil {
+		t.Skip("symlinks are not supported:", err)
+	}
+	os.Symlink(outside, filepath.Join(root, "out"))
+	os.Symlink(filepath.Join(root, "a.txt"), filepath.Join(root, "b.txt"))
+
+	o := New(Static(StaticOptions{RootPath: root, Prefix: "/s"}))
+	for _, url := range []string{"/s/secret.txt", "/s/out/secret.txt"} {
+		recorder := testStaticRequest(t, o, url)
+		expect(t, recorder.Code, http.StatusForbidden)
+	}
+	// the links inside of the root are served
+	recorder := testStaticRequest(t, o, "/s/b.txt")
+	expect(t, recorder.Body.String(), "a.txt")
+
+	o = New(Static(StaticOptions{RootPath: root, Prefix: "/s", FollowSymlinks: true}))
+	recorder = testStaticRequest(t, o, "/s/out/secret.txt")
+	expect(t, recorder.Body.String(), "secret.txt")
+
+	tg := New()
+	tg.Get("/dir/*name", Dir(root))
+	tg.Get("/secret", File(filepath.Join(root, "secret.txt")))
+	recorder = testStaticRequest(t, tg, "/dir/out/secret.txt")
+	expect(t, recorder.Code, http.StatusForbidden)
+	recorder = testStaticRequest(t, tg, "/secret")
+	expect(t, recorder.Code, http.StatusForbidden)
+}
+
+func TestStaticSymlinkedRoot(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "real/a.txt")
+	root := filepath.Join(dir, "root")
+	if err := os.Symlink(filepath.Join(dir, "real"), root); err != nil {
+		t.Skip("symlinks are not supported:", err)
+	}
+
+	o := New(Static(StaticOptions{
+		RootPath:    root,
+		Prefix:      "/s",
+		MemoryCache: MemoryCacheOptions{Size: 1 << 20},
+	}))
+	opt := prepareStaticOptions([]StaticOptions{{RootPath: root}})
+	real, _ := filepath.EvalSymlinks(filepath.Join(dir, "real"))
+	expect(t, opt.root.real, real)
+
+	// the link of the root is resolved once, and the cached files are not
+	// checked again
+	for i := 0; i < 2; i++ {
+		recorder := testStaticRequest(t, o, "/s/a.txt")
+		expect(t, recorder.Code, http.StatusOK)
+		expect(t, recorder.Body.String(), "real/a.txt")
+	}
+}
+
+func TestDirPolicy(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, ".env", "a.txt")
+
+	tg := New()
+	tg.Get("/dir/*name", Dir(dir))
+	tg.Get("/deny/*name", Dir(dir, FileOptions{DotFiles: DotFilesDeny}))
+	tg.Get("/allow/*name", Dir(dir, FileOptions{DotFiles: DotFilesAllow}))
+	tg.Get("/env", File(filepath.Join(dir, ".env")))
+
+	recorder := testStaticRequest(t, tg, "/dir/a.txt")
+	expect(t, recorder.Code, http.StatusOK)
+	recorder = testStaticRequest(t, tg, "/dir/.env")
+	expect(t, recorder.Code, http.StatusNotFound)
+	recorder = testStaticRequest(t, tg, "/deny/.env")
+	expect(t, recorder.Code, http.StatusForbidden)
+	recorder = testStaticRequest(t, tg, "/allow/.env")
+	expect(t, recorder.Code, http.StatusOK)
+	recorder = testStaticRequest(t, tg, "/env")
+	expect(t, recorder.Code, http.StatusNotFound)
+	recorder = testStaticRequest(t, tg, "/dir/%2e%2e/a.txt")
+	expect(t, recorder.Code, http.StatusForbidden)
+
+	expect(t, hasDotDot(`a\..\b`), true)
+	expect(t, hasDotDot("a..b/c"), false)
+	expect(t, hasDotFile("/a/.b/c"), true)
+	expect(t, hasDotFile("/a/b.c"), false)
+}
@@ -0,0 +1,272 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tango
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// some proxy http headers
+const (
+	HeaderForwarded       = "Forwarded"
+	HeaderXForwardedFor   = "X-Forwarded-For"
+	HeaderXForwardedProto = "X-Forwarded-Proto"
+	HeaderXForwardedHost  = "X-Forwarded-Host"
+	HeaderXRealIP         = "X-Real-IP"
+)
+
+// SetTrustedProxies sets the proxies whose forwarding headers are trusted when
+// resolving the client IP, scheme and host. Every proxy is a CIDR like
+// 10.0.0.0/8 or fd00::/8 or a single IP address. By default no proxy is
+// trusted and the forwarding headers are ignored.
+func (t *Tango) SetTrustedProxies(proxies ...string) error {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return fmt.Errorf("tango: invalid trusted proxy %q", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipnet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return fmt.Errorf("tango: invalid trusted proxy %q: %v", proxy, err)
+		}
+		nets = append(nets, ipnet)
+	}
+	t.trustedProxies = nets
+	return nil
+}
+
+// SetProxyHeader sets the header written by the trusted proxies, one of
+// HeaderXForwardedFor, the default, HeaderForwarded and HeaderXRealIP. The
+// other headers are ignored since the proxy may pass them through from the
+// client. X-Forwarded-Proto and X-Forwarded-Host are read with
+// X-Forwarded-For and X-Real-IP.
+func (t *Tango) SetProxyHeader(header string) error {
+	switch header = http.CanonicalHeaderKey(header); header {
+	case HeaderXForwardedFor, HeaderForwarded, http.CanonicalHeaderKey(HeaderXRealIP):
+		t.proxyHeader = header
+		return nil
+	}
+	return fmt.Errorf("tango: unsupported proxy header %q", header)
+}
+
+// TrustedProxies returns the trusted proxies networks
+func (t *Tango) TrustedProxies() []*net.IPNet {
+	return t.trustedProxies
+}
+
+func (t *Tango) isTrustedProxy(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range t.trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseHopIP parses a node of X-Forwarded-For, X-Real-IP or the for parameter
+// of Forwarded, e.g. 192.0.2.60, 192.0.2.60:80, "[2001:db8::1]:4711" or 2001:db8::1
+func parseHopIP(node string) net.IP {
+	node = strings.Trim(strings.TrimSpace(node), `"`)
+	if strings.HasPrefix(node, "[") {
+		end := strings.IndexByte(node, ']')
+		if end < 0 {
+			return nil
+		}
+		return net.ParseIP(node[1:end])
+	}
+	if ip := net.ParseIP(node); ip != nil {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		return net.ParseIP(host)
+	}
+	return nil
+}
+
+// forwardedHop is one hop reported by a proxy
+type forwardedHop struct {
+	// ip is nil if the node is obfuscated, unknown or invalid
+	ip    net.IP
+	proto string
+	host  string
+}
+
+// parseForwarded parses the RFC 7239 Forwarded headers
+func parseForwarded(values []string) []forwardedHop {
+	var hops []forwardedHop
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			var hop forwardedHop
+			for _, pair := range strings.Split(element, ";") {
+				kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+				if len(kv) != 2 {
+					continue
+				}
+				v := strings.Trim(kv[1], `"`)
+				switch strings.ToLower(kv[0]) {
+				case "for":
+					hop.ip = parseHopIP(v)
+				case "proto":
+					hop.proto = strings.ToLower(v)
+				case "host":
+					hop.host = v
+				}
+			}
+			hops = append(hops, hop)
+		}
+	}
+	return hops
+}
+
+// splitHeader splits comma separated values of all the header lines
+func splitHeader(header http.Header, key string) []string {
+	var res []string
+	for _, line := range header.Values(key) {
+		for _, v := range strings.Split(line, ",") {
+			res = append(res, strings.TrimSpace(v))
+		}
+	}
+	return res
+}
+
+// forwardedHops returns the hops reported by the proxies in the header
+// written by the trusted proxies, see Tango.SetProxyHeader
+func forwardedHops(header http.Header, proxyHeader string) []forwardedHop {
+	switch proxyHeader {
+	case HeaderForwarded:
+		return parseForwarded(header.Values(HeaderForwarded))
+	case http.CanonicalHeaderKey(HeaderXRealIP):
+		ip := strings.TrimSpace(header.Get(HeaderXRealIP))
+		if ip == "" {
+			return nil
+		}
+		return []forwardedHop{{
+			ip:    parseHopIP(ip),
+			proto: strings.ToLower(header.Get(HeaderXForwardedProto)),
+			host:  header.Get(HeaderXForwardedHost),
+		}}
+	}
+
+	ips := splitHeader(header, HeaderXForwardedFor)
+	hops := make([]forwardedHop, len(ips))
+	for i, ip := range ips {
+		hops[i].ip = parseHopIP(ip)
+	}
+
+	// X-Forwarded-Proto and X-Forwarded-Host are aligned with
+	// X-Forwarded-For when every proxy appends them, otherwise the
+	// value set by the nearest proxy is used.
+	protos := splitHeader(header, HeaderXForwardedProto)
+	hosts := splitHeader(header, HeaderXForwardedHost)
+	for i := range hops {
+		if len(protos) == len(hops) {
+			hops[i].proto = strings.ToLower(protos[i])
+		} else if len(protos) > 0 {
+			hops[i].proto = strings.ToLower(protos[len(protos)-1])
+		}
+		if len(hosts) == len(hops) {
+			hops[i].host = hosts[i]
+		} else if len(hosts) > 0 {
+			hops[i].host = hosts[len(hosts)-1]
+		}
+	}
+	return hops
+}
+
+// remoteHost returns the host part of the request's RemoteAddr
+func remoteHost(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return strings.Trim(req.RemoteAddr, "[]")
+	}
+	return host
+}
+
+// clientHop walks the proxy chain from right to left and returns the hop
+// of the first untrusted proxy. It returns false if the request is not
+// forwarded by a trusted proxy.
+func (ctx *Context) clientHop() (forwardedHop, bool) {
+	req := ctx.Req()
+	peer := net.ParseIP(remoteHost(req))
+	if !ctx.tan.isTrustedProxy(peer) {
+		return forwardedHop{}, false
+	}
+
+	hops := forwardedHops(req.Header, ctx.tan.proxyHeader)
+	if len(hops) == 0 && ctx.tan.proxyHeader != HeaderForwarded {
+		// the proxy may only forward the proto and the host, the peer
+		// is the client then
+		hop := forwardedHop{ip: peer}
+		if protos := splitHeader(req.Header, HeaderXForwardedProto); len(protos) > 0 {
+			hop.proto = strings.ToLower(protos[len(protos)-1])
+		}
+		if hosts := splitHeader(req.Header, HeaderXForwardedHost); len(hosts) > 0 {
+			hop.host = hosts[len(hosts)-1]
+		}
+		return hop, true
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		// an obfuscated or invalid node is the client, the nodes on its
+		// left cannot be trusted
+		if hops[i].ip == nil || !ctx.tan.isTrustedProxy(hops[i].ip) || i == 0 {
+			return hops[i], true
+		}
+	}
+	return forwardedHop{}, false
+}
+
+// IP returns the client IP. The forwarding headers are only used when the
+// request comes from a trusted proxy, see Tango.SetTrustedProxies. It's
+// unknown if the proxy doesn't know the client or obfuscates it.
+func (ctx *Context) IP() string {
+	if hop, ok := ctx.clientHop(); ok {
+		if hop.ip == nil {
+			return "unknown"
+		}
+		return hop.ip.String()
+	}
+	if host := remoteHost(ctx.Req()); host != "" {
+		return host
+	}
+	return "127.0.0.1"
+}
+
+// Scheme returns the scheme of the request, http or https. The forwarding
+// headers are only used when the request comes from a trusted proxy.
+func (ctx *Context) Scheme() string {
+	if hop, ok := ctx.clientHop(); ok && (hop.proto == "http" || hop.proto == "https") {
+		return hop.proto
+	}
+	if ctx.Req().TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// Host returns the host requested by the client. The forwarding headers are
+// only used when the request comes from a trusted proxy.
+func (ctx *Context) Host() string {
+	if hop, ok := ctx.clientHop(); ok && hop.host != "" {
+		return hop.host
+	}
+	return ctx.Req().Host
+}
@@ -0,0 +1,170 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tango
+
+import (
+	"bytes"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func testProxy(t *testing.T, o *Tango, remoteAddr string, header http.Header, expected string) {
+	buff := bytes.NewBufferString("")
+	recorder := httptest.NewRecorder()
+	recorder.Body = buff
+
+	req, err := http.NewRequest("GET", "http://localhost:8000/", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	req.RemoteAddr = remoteAddr
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	o.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, buff.String(), expected)
+}
+
+func newProxyTango(t *testing.T, proxies ...string) *Tango {
+	o := Classic()
+	if err := o.SetTrustedProxies(proxies...); err != nil {
+		t.Fatal(err)
+	}
+	o.Get("/", func(ctx *Context) string {
+		return ctx.IP() + " " + ctx.Scheme() + " " + ctx.Host()
+	})
+	return o
+}
+
+func TestSetTrustedProxies(t *testing.T) {
+	o := New()
+	expect(t, o.SetTrustedProxies("10.0.0.0/8", "192.168.1.1", "::1", "fd00::/8"), nil)
+	expect(t, len(o.TrustedProxies()), 4)
+	refute(t, o.SetTrustedProxies("10.0.0.0/33"), nil)
+	refute(t, o.SetTrustedProxies("proxy"), nil)
+}
+
+func TestIPUntrusted(t *testing.T) {
+	o := newProxyTango(t)
+
+	testProxy(t, o, "192.0.2.1:1234", http.Header{
+		"X-Forwarded-For":   {"203.0.113.1"},
+		"X-Forwarded-Proto": {"https"},
+		"X-Forwarded-Host":  {"example.com"},
+	}, "192.0.2.1 http localhost:8000")
+	testProxy(t, o, "[2001:db8::1]:1234", http.Header{
+		"X-Real-Ip": {"203.0.113.1"},
+	}, "2001:db8::1 http localhost:8000")
+	testProxy(t, o, "", nil, "127.0.0.1 http localhost:8000")
+}
+
+func TestIPXForwardedFor(t *testing.T) {
+	o := newProxyTango(t, "10.0.0.0/8", "fd00::/8")
+
+	testProxy(t, o, "10.0.0.1:1234", http.Header{
+		"X-Forwarded-For":   {"203.0.113.1, 198.51.100.1, 10.0.0.2"},
+		"X-Forwarded-Proto": {"https"},
+		"X-Forwarded-Host":  {"example.com"},
+	}, "198.51.100.1 https example.com")
+	testProxy(t, o, "[fd00::1]:1234", http.Header{
+		"X-Forwarded-For": {"2001:db8::1", "fd00::2"},
+	}, "2001:db8::1 http localhost:8000")
+	testProxy(t, o, "10.0.0.1:1234", http.Header{
+		"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"},
+	}, "10.0.0.3 http localhost:8000")
+	testProxy(t, o, "10.0.0.1:1234", http.Header{
+		"X-Forwarded-For": {"203.0.113.1, unknown, 10.0.0.2"},
+	}, "unknown http localhost:8000")
+	// the headers not written by the proxy are ignored
+	testProxy(t, o, "10.0.0.1:1234", http.Header{
+		"Forwarded":       {"for=6.6.6.6;proto=https;host=evil.com"},
+		"X-Real-Ip":       {"6.6.6.6"},
+		"X-Forwarded-For": {"203.0.113.9"},
+	}, "203.0.113.9 http localhost:8000")
+}
+
+func TestSetProxyHeader(t *testing.T) {
+	o := New()
+	expect(t, o.SetProxyHeader(HeaderForwarded), nil)
+	expect(t, o.SetProxyHeader("x-real-ip"), nil)
+	refute(t, o.SetProxyHeader("X-Client-IP"), nil)
+}
+
+func TestIPXRealIP(t *testing.T) {
+	o := newProxyTango(t, "10.0.0.1")
+	expect(t, o.SetProxyHeader(HeaderXRealIP), nil)
+
+	testProxy(t, o, "10.0.0.1:1234", http.Header{
+		"X-Real-Ip": {"203.0.113.1"},
+	}, "203.0.113.1 http localhost:8000")
+	testProxy(t, o, "10.0.0.1:1234", http.Header{
+		"X-Forwarded-For": {"6.6.6.6"},
+	}, "10.0.0.1 http localhost:8000")
+}
+
+func TestIPForwarded(t *testing.T) {
+	o := newProxyTango(t, "10.0.0.0/8")
+	expect(t, o.SetProxyHeader(HeaderForwarded), nil)
+
+	testProxy(t, o, "10.0.0.1:1234", http.Header{
+		"Forwarded": {`for=192.0.2.43;proto=https;host=example.com, for="[2001:db8:cafe::17]:4711";proto=https;host=example.org`,
+			"for=10.0.0.2"},
+		"X-Forwarded-For": {"203.0.113.1"},
+	}, "2001:db8:cafe::17 https example.org")
+	testProxy(t, o, "10.0.0.1:1234", http.Header{
+		"Forwarded": {`For="198.51.100.17:80";Proto=HTTPS`},
+	}, "198.51.100.17 https localhost:8000")
+	testProxy(t, o, "10.0.0.1:1234", http.Header{
+		"Forwarded": {`for=_hidden;proto=https, for=10.0.0.2`},
+	}, "unknown https localhost:8000")
+	testProxy(t, o, "10.0.0.1:1234", http.Header{
+		"X-Forwarded-For": {"203.0.113.1"},
+	}, "10.0.0.1 http localhost:8000")
+}
+
+func TestSchemeTLS(t *testing.T) {
+	buff := bytes.NewBufferString("")
+	recorder := httptest.NewRecorder()
+	recorder.Body = buff
+
+	o := newProxyTango(t)
+	req, err := http.NewRequest("GET", "https://localhost:8000/", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	req.RemoteAddr = "127.0.0.1:1234"
+	req.TLS = &tls.ConnectionState{}
+
+	o.ServeHTTP(recorder, req)
+	expect(t, buff.String(), "127.0.0.1 https localhost:8000")
+}
+
+func TestIPXForwardedProtoAligned(t *testing.T) {
+	o := newProxyTango(t, "10.0.0.0/8")
+
+	testProxy(t, o, "10.0.0.1:1234", http.Header{
+		"X-Forwarded-For":   {"203.0.113.1, 10.0.0.2"},
+		"X-Forwarded-Proto": {"https, http"},
+		"X-Forwarded-Host":  {"example.com, internal"},
+	}, "203.0.113.1 https example.com")
+}
+
+func TestSchemeWithoutXForwardedFor(t *testing.T) {
+	o := newProxyTango(t, "10.0.0.0/8")
+
+	// the trusted proxy only forwards the proto and the host
+	testProxy(t, o, "10.0.0.1:1234", http.Header{
+		"X-Forwarded-Proto": {"https"},
+		"X-Forwarded-Host":  {"example.com"},
+	}, "10.0.0.1 https example.com")
+	testProxy(t, o, "192.0.2.1:1234", http.Header{
+		"X-Forwarded-Proto": {"https"},
+		"X-Forwarded-Host":  {"example.com"},
+	}, "192.0.2.1 http localhost:8000")
+}
@@ -0,0 +1,71 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tango
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// PoisonReleased enables the use-after-release detection. When it is true,
+// Context and ResponseWriter are not put back into the pools once the
+// request has finished; they are poisoned instead, so that any later method
+// call panics with the request path and the stack trace where it was
+// released. It is a debug facility and should not be enabled in production.
+var PoisonReleased = false
+
+// releaseInfo records where a poisoned Context or ResponseWriter was released
+type releaseInfo struct {
+	method string
+	path   string
+	stack  []byte
+}
+
+func (r *releaseInfo) check(name string) {
+	if r == nil {
+		return
+	}
+	panic(fmt.Sprintf("tango: %s used after release, the request %s %s was finished at:\n%s",
+		name, r.method, r.path, r.stack))
+}
+
+func (ctx *Context) checkReleased() {
+	ctx.released.check("Context")
+}
+
+// release puts ctx and resp back into the pools, or poisons them if
+// PoisonReleased is enabled
+func (t *Tango) release(ctx *Context, resp *responseWriter) {
+	ctx.logState.freeze()
+	if !PoisonReleased {
+		t.ctxPool.Put(ctx)
+		t.respPool.Put(resp)
+		return
+	}
+
+	info := &releaseInfo{
+		method: ctx.req.Method,
+		path:   ctx.req.URL.Path,
+		stack:  debug.Stack(),
+	}
+	ctx.Logger = poisonedLogger{info}
+	ctx.ResponseWriter = resp
+	ctx.released = info
+	resp.released = info
+}
+
+// poisonedLogger panics on every log call of a released Context
+type poisonedLogger struct {
+	info *releaseInfo
+}
+
+func (l poisonedLogger) Debugf(format string, v ...interface{}) { l.info.check("Logger") }
+func (l poisonedLogger) Debug(v ...interface{})                 { l.info.check("Logger") }
+func (l poisonedLogger) Infof(format string, v ...interface{})  { l.info.check("Logger") }
+func (l poisonedLogger) Info(v ...interface{})                  { l.info.check("Logger") }
+func (l poisonedLogger) Warnf(format string, v ...interface{})  { l.info.check("Logger") }
+func (l poisonedLogger) Warn(v ...interface{})                  { l.info.check("Logger") }
+func (l poisonedLogger) Errorf(format string, v ...interface{}) { l.info.check("Logger") }
+func (l poisonedLogger) Error(v ...interface{})                 { l.info.check("Logger") }
@@ -0,0 +1,91 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tango
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func catchPanic(f func()) (msg string) {
+	defer func() {
+		if e := recover(); e != nil {
+			msg = fmt.Sprint(e)
+		}
+	}()
+	f()
+	return
+}
+
+func TestPoisonReleased(t *testing.T) {
+	PoisonReleased = true
+	defer func() {
+		PoisonReleased = false
+	}()
+
+	buff := bytes.NewBufferString("")
+	recorder := httptest.NewRecorder()
+	recorder.Body = buff
+
+	var kept *Context
+	var resp ResponseWriter
+	o := Classic()
+	o.Get("/released", func(ctx *Context) string {
+		kept = ctx
+		resp = ctx.ResponseWriter
+		return "released"
+	})
+
+	req, err := http.NewRequest("GET", "http://localhost:8000/released", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	o.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, buff.String(), "released")
+
+	for _, f := range []func(){
+		func() { kept.Req() },
+		func() { kept.Params() },
+		func() { kept.Forms() },
+		func() { kept.Header() },
+		func() { kept.WriteString("late") },
+		func() { kept.Info("late") },
+		func() { kept.Done() },
+		func() { kept.SetData("a", 1) },
+		func() { kept.GetData("a") },
+		func() { kept.Data() },
+		func() { kept.RequestID() },
+		func() { kept.AddLogFields("a", 1) },
+		func() { kept.LogFields() },
+		func() { resp.Status() },
+	} {
+		msg := catchPanic(f)
+		expect(t, strings.Contains(msg, "used after release"), true)
+		expect(t, strings.Contains(msg, "GET /released"), true)
+		expect(t, strings.Contains(msg, "release.go"), true)
+	}
+}
+
+func TestReleasedPooled(t *testing.T) {
+	var kept *Context
+	o := Classic()
+	o.Get("/", func(ctx *Context) {
+		kept = ctx
+	})
+
+	req, err := http.NewRequest("GET", "http://localhost:8000/", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	o.ServeHTTP(httptest.NewRecorder(), req)
+	expect(t, catchPanic(func() { kept.Req() }), "")
+}
@@ -0,0 +1,308 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tango
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TemplateResult describes a template to be rendered by Return, an action
+// returns it or, with the HTML marker, (templateName, data).
+type TemplateResult struct {
+	Name string
+	Data interface{}
+}
+
+// Render returns a TemplateResult
+func Render(name string, data interface{}) *TemplateResult {
+	return &TemplateResult{name, data}
+}
+
+// RendererOptions defines the options of a Renderer
+type RendererOptions struct {
+	// Directory is the templates directory, default is "./templates"
+	Directory string
+	// Extensions are the templates file extensions, default is [".html", ".tmpl"]
+	Extensions []string
+	// Layout is the name of the layout template, the page is rendered
+	// where it calls {{yield}}. Default is no layout.
+	Layout string
+	// Funcs are added to the default template functions
+	Funcs template.FuncMap
+	// LeftDelim and RightDelim are the template delimiters, default is {{ and }}
+	LeftDelim  string
+	RightDelim string
+	// AssetPrefix is the URL prefix used by the Asset function, default is "/public"
+	AssetPrefix string
+	// Manifest maps the names passed to the Asset function to the
+	// fingerprinted names, e.g. {{Asset "app.js"}} to /public/app.3f9a1c.js
+	Manifest *Manifest
+	// Reload reloads the changed templates from disk before rendering,
+	// it should only be enabled in development mode.
+	Reload bool
+}
+
+// Renderer renders the html/template templates in a directory. The name of
+// a template is its path relative to the directory without the extension,
+// e.g. "users/show" for templates/users/show.html, so that the partials
+// could be included with {{template "partials/header" .}}.
+type Renderer struct {
+	opt RendererOptions
+
+	lock      sync.RWMutex
+	templates *template.Template
+	// layouts is never executed, so that it could be cloned for every layout rendering
+	layouts  *template.Template
+	modTimes map[string]time.Time
+}
+
+// NewRenderer creates a Renderer and loads the templates
+func NewRenderer(opts ...RendererOptions) (*Renderer, error) {
+	var opt RendererOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.Directory == "" {
+		opt.Directory = "./templates"
+	}
+	if len(opt.Extensions) == 0 {
+		opt.Extensions = []string{".html", ".tmpl"}
+	}
+	if opt.AssetPrefix == "" {
+		opt.AssetPrefix = "/public"
+	}
+
+	r := &Renderer{opt: opt}
+	if err := r.Load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Renderer) isTemplate(name string) bool {
+	ext := filepath.Ext(name)
+	for _, e := range r.opt.Extensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// Funcs returns the template functions, yield is replaced when rendering
+func (r *Renderer) Funcs() template.FuncMap {
+	funcs := template.FuncMap{
+		"URLFor": URLFor,
+		"Asset": func(name string) string {
+			if r.opt.Manifest != nil {
+				name = r.opt.Manifest.Lookup(name)
+			}
+			return path.Join(r.opt.AssetPrefix, name)
+		},
+		"yield": func() (template.HTML, error) {
+			return "", errors.New("tango: yield called outside of a layout")
+		},
+	}
+	for k, v := range r.opt.Funcs {
+		funcs[k] = v
+	}
+	return funcs
+}
+
+// Load parses all the templates in the directory
+func (r *Renderer) Load() error {
+	t := template.New("").Delims(r.opt.LeftDelim, r.opt.RightDelim).Funcs(r.Funcs())
+	modTimes := make(map[string]time.Time)
+	err := filepath.Walk(r.opt.Directory, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !r.isTemplate(p) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(r.opt.Directory, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(strings.TrimSuffix(rel, filepath.Ext(rel)))
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if _, err = t.New(name).Parse(string(content)); err != nil {
+			return err
+		}
+		modTimes[p] = info.ModTime()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	layouts, err := t.Clone()
+	if err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	r.templates = t
+	r.layouts = layouts
+	r.modTimes = modTimes
+	r.lock.Unlock()
+	return nil
+}
+
+// changed returns true if a template has been added, removed or modified
+func (r *Renderer) changed() bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	var count int
+	var changed bool
+	filepath.Walk(r.opt.Directory, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			changed = true
+			return err
+		}
+		if info.IsDir() || !r.isTemplate(p) {
+			return nil
+		}
+		count++
+		if modTime, ok := r.modTimes[p]; !ok || !modTime.Equal(info.ModTime()) {
+			changed = true
+		}
+		return nil
+	})
+	return changed || count != len(r.modTimes)
+}
+
+// Execute renders the template name with data to w, the page is
+// wrapped in the layout if there is one
+func (r *Renderer) Execute(w io.Writer, name string, data interface{}) error {
+	if r.opt.Reload && r.changed() {
+		if err := r.Load(); err != nil {
+			return err
+		}
+	}
+
+	r.lock.RLock()
+	t, layouts := r.templates, r.layouts
+	r.lock.RUnlock()
+
+	if t.Lookup(name) == nil {
+		return fmt.Errorf("tango: template %s is not found", name)
+	}
+	if r.opt.Layout == "" {
+		return t.ExecuteTemplate(w, name, data)
+	}
+
+	var page bytes.Buffer
+	if err := t.ExecuteTemplate(&page, name, data); err != nil {
+		return err
+	}
+	layout, err := layouts.Clone()
+	if err != nil {
+		return err
+	}
+	layout.Funcs(template.FuncMap{
+		"yield": func() (template.HTML, error) {
+			return template.HTML(page.String()), nil
+		},
+	})
+	return layout.ExecuteTemplate(w, r.opt.Layout, data)
+}
+
+// mergeData merges the data of the context store into data if data is nil
+// or a map[string]interface{}
+func mergeData(ctx *Context, data interface{}) interface{} {
+	if len(ctx.data) == 0 {
+		return data
+	}
+	m, ok := data.(map[string]interface{})
+	if !ok && data != nil {
+		return data
+	}
+	merged := make(map[string]interface{}, len(ctx.data)+len(m))
+	for k, v := range ctx.data {
+		merged[k] = v
+	}
+	for k, v := range m {
+		merged[k] = v
+	}
+	return merged
+}
+
+func (ctx *Context) render(status int, name string, data interface{}) error {
+	if ctx.tan.Renderer == nil {
+		return errors.New("tango: no renderer")
+	}
+
+	var buf bytes.Buffer
+	if err := ctx.tan.Renderer.Execute(&buf, name, mergeData(ctx, data)); err != nil {
+		return err
+	}
+	if len(ctx.Header().Get(HeaderContentType)) == 0 {
+		ctx.Header().Set(HeaderContentType, "text/html; charset=UTF-8")
+	}
+	ctx.WriteHeader(status)
+	_, err := ctx.Write(buf.Bytes())
+	return err
+}
+
+// Render renders the template name with data by Tango.Renderer. If data is
+// nil or a map[string]interface{}, the data set by SetData is merged into it.
+func (ctx *Context) Render(name string, data interface{}) error {
+	return ctx.render(http.StatusOK, name, data)
+}
+
+// URLFor builds an URL from a route pattern and the params values, e.g.
+// URLFor("/users/:id/(*path)", "id", 5, "path", "a/b") returns "/users/5/a/b"
+func URLFor(pattern string, params ...interface{}) (string, error) {
+	if len(params)%2 != 0 {
+		return "", errors.New("tango: URLFor params should be name and value pairs")
+	}
+	values := make(map[string]string, len(params)/2)
+	for i := 0; i < len(params); i += 2 {
+		name := strings.TrimLeft(fmt.Sprint(params[i]), ":*")
+		values[name] = fmt.Sprint(params[i+1])
+	}
+
+	var buf bytes.Buffer
+	for _, n := range parseNodes(pattern) {
+		if n.tp == snode {
+			buf.WriteString(n.content)
+			continue
+		}
+		name := strings.TrimLeft(n.content, ":*")
+		value, ok := values[name]
+		if !ok {
+			return "", fmt.Errorf("tango: URLFor param %s is missing", name)
+		}
+		if n.tp == rnode && n.regexp.FindString(value) != value {
+			return "", fmt.Errorf("tango: URLFor param %s doesn't match the pattern", name)
+		}
+		if n.tp == anode {
+			segments := strings.Split(value, "/")
+			for i, s := range segments {
+				segments[i] = url.PathEscape(s)
+			}
+			buf.WriteString(strings.Join(segments, "/"))
+		} else {
+			buf.WriteString(url.PathEscape(value))
+		}
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,167 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tango
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTemplates(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func newRenderTango(t *testing.T, opt RendererOptions) *Tango {
+	r, err := NewRenderer(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := Classic()
+	o.Renderer = r
+	return o
+}
+
+func testRender(t *testing.T, o *Tango, url string, code int, expected string) {
+	buff := bytes.NewBufferString("")
+	recorder := httptest.NewRecorder()
+	recorder.Body = buff
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	o.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, code)
+	if code == http.StatusOK {
+		expect(t, recorder.Header().Get("Content-Type"), "text/html; charset=UTF-8")
+	}
+	expect(t, buff.String(), expected)
+}
+
+type HTMLAction struct {
+	HTML
+}
+
+func (HTMLAction) Get() (string, interface{}) {
+	return "users/show", map[string]interface{}{
+		"Name": "<lunny>",
+	}
+}
+
+type HTMLStringAction struct {
+	HTML
+}
+
+func (HTMLStringAction) Get() string {
+	return "<p>hello</p>"
+}
+
+type HTMLStatusAction struct {
+	Ctx
+}
+
+func (a *HTMLStatusAction) Get() (int, interface{}) {
+	a.SetData("Title", "missing")
+	return http.StatusNotFound, Render("errors/404", nil)
+}
+
+func TestRenderLayout(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplates(t, dir, map[string]string{
+		"layout.html":          `<title>{{.Title}}</title>{{template "partials/header" .}}{{yield}}`,
+		"partials/header.html": `<a href="{{URLFor "/users/:id" "id" 5}}">{{Asset "app.js"}}</a>`,
+		"users/show.html":      `<p>{{.Name}} {{.Title}}</p>`,
+		"errors/404.tmpl":      `<p>{{.Title}}</p>`,
+		"ignored.txt":          `{{`,
+	})
+
+	o := newRenderTango(t, RendererOptions{Directory: dir, Layout: "layout"})
+	o.Use(HandlerFunc(func(ctx *Context) {
+		ctx.SetData("Title", "Users")
+		ctx.Next()
+	}))
+	o.Get("/users", new(HTMLAction))
+	o.Get("/string", new(HTMLStringAction))
+	o.Get("/missing", new(HTMLStatusAction))
+	o.Get("/ctx", func(ctx *Context) error {
+		return ctx.Render("users/show", map[string]interface{}{
+			"Name":  "ctx",
+			"Title": "Override",
+		})
+	})
+
+	testRender(t, o, "http://localhost:8000/users", http.StatusOK,
+		`<title>Users</title><a href="/users/5">/public/app.js</a><p>&lt;lunny&gt; Users</p>`)
+	testRender(t, o, "http://localhost:8000/string", http.StatusOK, `<p>hello</p>`)
+	testRender(t, o, "http://localhost:8000/missing", http.StatusNotFound,
+		`<title>missing</title><a href="/users/5">/public/app.js</a><p>missing</p>`)
+	testRender(t, o, "http://localhost:8000/ctx", http.StatusOK,
+		`<title>Override</title><a href="/users/5">/public/app.js</a><p>ctx Override</p>`)
+}
+
+func TestRenderNotFound(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplates(t, dir, map[string]string{
+		"index.html": `index`,
+	})
+
+	o := newRenderTango(t, RendererOptions{Directory: dir})
+	o.Get("/", func() *TemplateResult {
+		return Render("missing", nil)
+	})
+	testRender(t, o, "http://localhost:8000/", http.StatusInternalServerError,
+		"tango: template missing is not found")
+}
+
+func TestRenderReload(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplates(t, dir, map[string]string{
+		"index.html": `old`,
+	})
+
+	o := newRenderTango(t, RendererOptions{Directory: dir, Reload: true})
+	o.Get("/", func() *TemplateResult {
+		return Render("index", nil)
+	})
+	testRender(t, o, "http://localhost:8000/", http.StatusOK, "old")
+
+	writeTemplates(t, dir, map[string]string{
+		"index.html": `new`,
+	})
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(filepath.Join(dir, "index.html"), future, future)
+	testRender(t, o, "http://localhost:8000/", http.StatusOK, "new")
+}
+
+func TestURLFor(t *testing.T) {
+	u, err := URLFor("/users/:id/files/(*path)", ":id", 5, "path", "a b/c")
+	expect(t, err, nil)
+	expect(t, u, "/users/5/files/a%20b/c")
+
+	u, err = URLFor("/(:id[0-9]+)", "id", 12)
+	expect(t, err, nil)
+	expect(t, u, "/12")
+
+	_, err = URLFor("/(:id[0-9]+)", "id", "abc")
+	refute(t, err, nil)
+	_, err = URLFor("/:id")
+	refute(t, err, nil)
+	_, err = URLFor("/:id", "id")
+	refute(t, err, nil)
+}
@@ -0,0 +1,133 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tango
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+// RequestIDOptions defines the options of RequestID
+type RequestIDOptions struct {
+	// Header is the header of the request ID, default is X-Request-ID
+	Header string
+	// Generator returns a new request ID, default is NewRequestID
+	Generator func() string
+	// Validate returns true if the incoming request ID is valid, otherwise
+	// a new one is generated. Default is ValidRequestID.
+	Validate func(id string) bool
+	// IgnoreIncoming always generates a new request ID
+	IgnoreIncoming bool
+}
+
+// ValidRequestID returns true if id has 1 to 128 letters, digits, or
+// '-', '_', '.', ':' characters
+func ValidRequestID(id string) bool {
+	if len(id) == 0 || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c == '-' || c == '_' || c == '.' || c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// crockford is the Crockford's base32 alphabet, its order is the order of
+// the ASCII characters
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+var requestIDGen struct {
+	sync.Mutex
+	ms   uint64
+	rand [10]byte
+}
+
+// NewRequestID returns a 26 characters ULID, the IDs are sorted by their
+// generation time, and the IDs generated in the same millisecond are
+// increasing.
+func NewRequestID() string {
+	ms := uint64(time.Now().UnixMilli())
+
+	g := &requestIDGen
+	g.Lock()
+	if ms <= g.ms {
+		// keep the order by increasing the random part
+		ms = g.ms
+		for i := len(g.rand) - 1; i >= 0; i-- {
+			g.rand[i]++
+			if g.rand[i] != 0 {
+				break
+			}
+		}
+	} else {
+		g.ms = ms
+		rand.Read(g.rand[:])
+	}
+	var id [16]byte
+	binary.BigEndian.PutUint16(id[:2], uint16(ms>>32))
+	binary.BigEndian.PutUint32(id[2:6], uint32(ms))
+	copy(id[6:], g.rand[:])
+	g.Unlock()
+
+	// 128 bits are encoded as 26 characters of 5 bits, from the high bits
+	var buf [26]byte
+	hi := binary.BigEndian.Uint64(id[:8])
+	lo := binary.BigEndian.Uint64(id[8:])
+	for i := len(buf) - 1; i >= 0; i-- {
+		buf[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(buf[:])
+}
+
+// RequestID returns the ID of the request, it's empty if the RequestID
+// middleware isn't used
+func (ctx *Context) RequestID() string {
+	ctx.checkReleased()
+	return ctx.requestID
+}
+
+// RequestID returns a middleware reading the request ID from the header, or
+// generating a new one if it's missing or invalid. The ID is returned by
+// Context.RequestID, written to the response header, and added to the
+// records of ctx.Logger as the request_id field.
+func RequestID(opts ...RequestIDOptions) HandlerFunc {
+	var opt RequestIDOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.Header == "" {
+		opt.Header = HeaderXRequestID
+	}
+	if opt.Generator == nil {
+		opt.Generator = NewRequestID
+	}
+	if opt.Validate == nil {
+		opt.Validate = ValidRequestID
+	}
+
+	return func(ctx *Context) {
+		var id string
+		if !opt.IgnoreIncoming {
+			id = ctx.Req().Header.Get(opt.Header)
+		}
+		if id == "" || !opt.Validate(id) {
+			id = opt.Generator()
+		}
+		ctx.requestID = id
+		ctx.logState.reset()
+		ctx.Header().Set(opt.Header, id)
+		ctx.Next()
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tango
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"gitea.com/lunny/log"
+)
+
+func TestRequestID(t *testing.T) {
+	buff := bytes.NewBufferString("")
+	o := NewWithLog(log.New(buff, "", 0), RequestID(), Return())
+	o.Get("/", func(ctx *Context) string {
+		ctx.Info("hello")
+		return ctx.RequestID()
+	})
+
+	recorder := testStaticRequest(t, o, "/", HeaderXRequestID, "abc-123")
+	expect(t, recorder.Body.String(), "abc-123")
+	expect(t, recorder.Header().Get(HeaderXRequestID), "abc-123")
+	expect(t, buff.String(), "hello method=GET path=/ route=/ request_id=abc-123 ip=127.0.0.1\n")
+
+	// the invalid IDs are replaced
+	for _, id := range []string{"", "a b", "<script>", strings.Repeat("a", 129)} {
+		recorder = testStaticRequest(t, o, "/", HeaderXRequestID, id)
+		generated := recorder.Header().Get(HeaderXRequestID)
+		expect(t, len(generated), 26)
+		expect(t, recorder.Body.String(), generated)
+	}
+
+}
+
+func TestRequestIDOptions(t *testing.T) {
+	o := New(RequestID(RequestIDOptions{
+		Header:         "X-Trace-ID",
+		Generator:      func() string { return "generated" },
+		IgnoreIncoming: true,
+	}))
+	o.Get("/", func() {})
+
+	recorder := testStaticRequest(t, o, "/", "X-Trace-ID", "incoming")
+	expect(t, recorder.Header().Get("X-Trace-ID"), "generated")
+}
+
+func TestRequestIDAccessLog(t *testing.T) {
+	buff := bytes.NewBufferString("")
+	o := New(AccessLog(AccessLogOptions{Output: buff, Format: "{request_id}"}), RequestID())
+	o.Get("/", func() {})
+
+	req, _ := http.NewRequest("GET", "http://localhost:8000/", nil)
+	req.Header.Set(HeaderXRequestID, "abc")
+	o.ServeHTTP(httptest.NewRecorder(), req)
+	expect(t, buff.String(), "abc\n")
+}
+
+func TestNewRequestID(t *testing.T) {
+	ids := make([]string, 1000)
+	for i := range ids {
+		ids[i] = NewRequestID()
+		expect(t, len(ids[i]), 26)
+		expect(t, ValidRequestID(ids[i]), true)
+	}
+	expect(t, sort.StringsAreSorted(ids), true)
+	expect(t, ids[0] != ids[1], true)
+}
@@ -0,0 +1,193 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tango
+
+import (
+	"fmt"
+	"sync"
+)
+
+// requestLogState holds the fields of a request, they are read when logging
+// so that the fields added later, e.g. by an authentication middleware,
+// appear in the records of the loggers injected before
+type requestLogState struct {
+	lock sync.Mutex
+	ctx  *Context
+	// static are the method, path, request_id and ip fields, they are
+	// computed once and reset when the request or its ID is changed
+	static []interface{}
+	// route is added once it's matched
+	route string
+	extra []interface{}
+}
+
+func (s *requestLogState) add(keyvals []interface{}) {
+	s.lock.Lock()
+	s.extra = append(s.extra, keyvals...)
+	s.lock.Unlock()
+}
+
+func (s *requestLogState) extraFields() []interface{} {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]interface{}(nil), s.extra...)
+}
+
+// update computes the fields of the request which are not known yet, it
+// should be called with the lock held
+func (s *requestLogState) update() {
+	ctx := s.ctx
+	if ctx == nil {
+		return
+	}
+	if s.static == nil {
+		req := ctx.req
+		s.static = make([]interface{}, 0, 8)
+		s.static = append(s.static, "method", req.Method, "path", req.URL.Path)
+		if ctx.requestID != "" {
+			s.static = append(s.static, "request_id", ctx.requestID)
+		}
+		s.static = append(s.static, "ip", ctx.IP())
+	}
+	if s.route == "" && ctx.matched && ctx.route != nil {
+		s.route = ctx.route.Pattern()
+	}
+}
+
+// reset computes the static fields again on the next record, the fields of
+// a frozen state are kept
+func (s *requestLogState) reset() {
+	s.lock.Lock()
+	if s.ctx != nil {
+		s.static = nil
+	}
+	s.lock.Unlock()
+}
+
+func (s *requestLogState) fields() []interface{} {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.update()
+	fields := make([]interface{}, 0, len(s.static)+2+len(s.extra))
+	// method and path come first
+	fields = append(fields, s.static[:4]...)
+	if s.route != "" {
+		fields = append(fields, "route", s.route)
+	}
+	fields = append(fields, s.static[4:]...)
+	return append(fields, s.extra...)
+}
+
+// freeze keeps the fields when the request is finished, so that the loggers
+// used after don't read the pooled Context
+func (s *requestLogState) freeze() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.update()
+	s.ctx = nil
+}
+
+// detach returns a frozen copy of the state for a detached context, the
+// fields added to the copy don't change the request
+func (s *requestLogState) detach() *requestLogState {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.update()
+	return &requestLogState{
+		static: s.static,
+		route:  s.route,
+		extra:  append([]interface{}(nil), s.extra...),
+	}
+}
+
+// requestLogger is the FieldLogger of a request, every record has the
+// method, path, route, request_id and ip fields, and the fields added by
+// Context.AddLogFields
+type requestLogger struct {
+	state *requestLogState
+	base  FieldLogger
+}
+
+// Log implementes FieldLogger
+func (l *requestLogger) Log(level LogLevel, msg string, keyvals ...interface{}) {
+	l.print(1, level, []interface{}{msg}, keyvals)
+}
+
+// print logs the operands v with the fields of the request, a bridged Logger
+// joins them as usual. calldepth is the number of the frames between the
+// caller to report and print.
+func (l *requestLogger) print(calldepth int, level LogLevel, v []interface{}, keyvals []interface{}) {
+	fields := append(l.state.fields(), keyvals...)
+	if bridge, ok := l.base.(*fieldLogger); ok {
+		bridge.print(calldepth+1, level, v, fields)
+		return
+	}
+	l.base.Log(level, sprint(v), fields...)
+}
+
+// With implementes FieldLogger
+func (l *requestLogger) With(keyvals ...interface{}) FieldLogger {
+	return &requestLogger{l.state, l.base.With(keyvals...)}
+}
+
+// Debugf implementes Logger interface
+func (l *requestLogger) Debugf(format string, v ...interface{}) {
+	l.print(1, LevelDebug, []interface{}{fmt.Sprintf(format, v...)}, nil)
+}
+
+// Debug implementes Logger interface
+func (l *requestLogger) Debug(v ...interface{}) {
+	l.print(1, LevelDebug, v, nil)
+}
+
+// Infof implementes Logger interface
+func (l *requestLogger) Infof(format string, v ...interface{}) {
+	l.print(1, LevelInfo, []interface{}{fmt.Sprintf(format, v...)}, nil)
+}
+
+// Info implementes Logger interface
+func (l *requestLogger) Info(v ...interface{}) {
+	l.print(1, LevelInfo, v, nil)
+}
+
+// Warnf implementes Logger interface
+func (l *requestLogger) Warnf(format string, v ...interface{}) {
+	l.print(1, LevelWarn, []interface{}{fmt.Sprintf(format, v...)}, nil)
+}
+
+// Warn implementes Logger interface
+func (l *requestLogger) Warn(v ...interface{}) {
+	l.print(1, LevelWarn, v, nil)
+}
+
+// Errorf implementes Logger interface
+func (l *requestLogger) Errorf(format string, v ...interface{}) {
+	l.print(1, LevelError, []interface{}{fmt.Sprintf(format, v...)}, nil)
+}
+
+// Error implementes Logger interface
+func (l *requestLogger) Error(v ...interface{}) {
+	l.print(1, LevelError, v, nil)
+}
+
+// newRequestLogger replaces ctx.Logger by a child logger of the request
+func (ctx *Context) newRequestLogger() {
+	ctx.logState = &requestLogState{ctx: ctx}
+	ctx.Logger = &requestLogger{ctx.logState, ctx.tan.fieldLogger}
+}
+
+// AddLogFields adds the key/value fields, e.g. "user_id", 5, to every record
+// of ctx.Logger during the request, including the loggers injected into the
+// actions before, and to the AccessLog JSON and {fields} token
+func (ctx *Context) AddLogFields(keyvals ...interface{}) {
+	ctx.checkReleased()
+	ctx.logState.add(keyvals)
+}
+
+// LogFields returns the fields added by AddLogFields
+func (ctx *Context) LogFields() []interface{} {
+	ctx.checkReleased()
+	return ctx.logState.extraFields()
+}
@@ -0,0 +1,152 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tango
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gitea.com/lunny/log"
+)
+
+type RequestLoggerAction struct {
+	Log
+}
+
+func (a *RequestLoggerAction) Get() string {
+	a.Infof("hello %s", "tango")
+	return "ok"
+}
+
+func testRequestLogger(t *testing.T, handlers ...Handler) (*bytes.Buffer, *Tango) {
+	buff := bytes.NewBufferString("")
+	logger := NewSlogLogger(slog.New(slog.NewJSONHandler(buff, nil)))
+	o := NewWithLog(logger, handlers...)
+	return buff, o
+}
+
+func decodeRecords(t *testing.T, buff *bytes.Buffer) []map[string]interface{} {
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buff.String()), "\n") {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestRequestLogger(t *testing.T) {
+	access := bytes.NewBufferString("")
+	buff, o := testRequestLogger(t,
+		AccessLog(AccessLogOptions{Output: access, Format: AccessLogJSON}),
+		RequestID(), Logging(), Return())
+	// the field is added after the logger is injected into the action
+	o.Get("/users/:id", new(RequestLoggerAction), HandlerFunc(func(ctx *Context) {
+		ctx.AddLogFields("user_id", 5)
+		ctx.Next()
+	}))
+
+	req, _ := http.NewRequest("GET", "http://localhost:8000/users/5", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set(HeaderXRequestID, "abc")
+	o.ServeHTTP(httptest.NewRecorder(), req)
+
+	records := decodeRecords(t, buff)
+	expect(t, len(records), 2)
+	record := records[0]
+	expect(t, record["msg"], "hello tango")
+	expect(t, record["method"], "GET")
+	expect(t, record["path"], "/users/5")
+	expect(t, record["route"], "/users/:id")
+	expect(t, record["request_id"], "abc")
+	expect(t, record["ip"], "10.0.0.1")
+	expect(t, record["user_id"], float64(5))
+	expect(t, records[1]["msg"], "Completed")
+	expect(t, records[1]["user_id"], float64(5))
+
+	var line map[string]interface{}
+	expect(t, json.Unmarshal(access.Bytes(), &line), nil)
+	expect(t, line["request_id"], "abc")
+	expect(t, line["user_id"], float64(5))
+	expect(t, line["status"], float64(200))
+}
+
+func TestRequestLoggerFields(t *testing.T) {
+	access := bytes.NewBufferString("")
+	buff, o := testRequestLogger(t, AccessLog(AccessLogOptions{Output: access, Format: "{status} {fields}"}), Return())
+	var detached *Context
+	o.Get("/", func(ctx *Context) {
+		ctx.AddLogFields("user", "a b")
+		detached = ctx.Detach()
+		// the fields added to the copy don't change the request
+		detached.AddLogFields("job", 2)
+		ctx.Logger.(FieldLogger).With("step", 1).Log(LevelWarn, "with")
+	})
+
+	req, _ := http.NewRequest("GET", "http://localhost:8000/", nil)
+	o.ServeHTTP(httptest.NewRecorder(), req)
+	expect(t, access.String(), "200 user=\"a b\"\n")
+
+	// the fields are kept after the request
+	detached.Info("later")
+	records := decodeRecords(t, buff)
+	expect(t, len(records), 2)
+	expect(t, records[0]["step"], float64(1))
+	expect(t, records[0]["user"], "a b")
+	expect(t, records[0]["job"], nil)
+	expect(t, records[1]["msg"], "later")
+	expect(t, records[1]["path"], "/")
+	expect(t, records[1]["route"], "/")
+	expect(t, records[1]["user"], "a b")
+	expect(t, records[1]["job"], float64(2))
+}
+
+func TestRequestLoggerRequestID(t *testing.T) {
+	// the request ID is set after the first record
+	buff, o := testRequestLogger(t, HandlerFunc(func(ctx *Context) {
+		ctx.Info("first")
+		ctx.Next()
+	}), RequestID(), Return())
+	o.Get("/", func(ctx *Context) {
+		ctx.Info("second")
+	})
+
+	req, _ := http.NewRequest("GET", "http://localhost:8000/", nil)
+	req.Header.Set(HeaderXRequestID, "abc")
+	o.ServeHTTP(httptest.NewRecorder(), req)
+
+	records := decodeRecords(t, buff)
+	expect(t, len(records), 2)
+	expect(t, records[0]["request_id"], nil)
+	expect(t, records[1]["request_id"], "abc")
+	expect(t, records[1]["ip"], "127.0.0.1")
+}
+
+func TestRequestLoggerCaller(t *testing.T) {
+	buff := bytes.NewBufferString("")
+	o := NewWithLog(log.New(buff, "", log.Lshortfile), Return())
+	o.Get("/", func(ctx *Context) {
+		ctx.Info("info")
+		ctx.Warnf("warn %d", 1)
+		ctx.Logger.(FieldLogger).Log(LevelError, "error")
+	})
+
+	req, _ := http.NewRequest("GET", "http://localhost:8000/", nil)
+	o.ServeHTTP(httptest.NewRecorder(), req)
+
+	// the records report the handler instead of the loggers of tango
+	lines := strings.Split(strings.TrimSpace(buff.String()), "\n")
+	expect(t, len(lines), 3)
+	for _, line := range lines {
+		expect(t, strings.HasPrefix(line, "requestlogger_test.go:"), true)
+	}
+}
@@ -28,22 +28,41 @@ type ResponseWriter interface {
 
 type responseWriter struct {
 	http.ResponseWriter
-	status int
-	size   int
+	status   int
+	size     int
+	hijacked bool
+
+	released *releaseInfo
 }
 
 func (rw *responseWriter) reset(w http.ResponseWriter) {
 	rw.ResponseWriter = w
 	rw.status = 0
 	rw.size = 0
+	rw.hijacked = false
+	rw.released = nil
+}
+
+func (rw *responseWriter) Header() http.Header {
+	rw.released.check("ResponseWriter")
+	return rw.ResponseWriter.Header()
 }
 
 func (rw *responseWriter) WriteHeader(s int) {
+	rw.released.check("ResponseWriter")
 	rw.status = s
+	// the connection has been taken over, only record the status
+	if rw.hijacked {
+		return
+	}
 	rw.ResponseWriter.WriteHeader(s)
 }
 
 func (rw *responseWriter) Write(b []byte) (int, error) {
+	rw.released.check("ResponseWriter")
+	if rw.hijacked {
+		return 0, http.ErrHijacked
+	}
 	if !rw.Written() {
 		// The status will be StatusOK if WriteHeader has not been called yet
 		rw.WriteHeader(http.StatusOK)
@@ -54,32 +73,84 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 }
 
 func (rw *responseWriter) Status() int {
+	rw.released.check("ResponseWriter")
 	return rw.status
 }
 
 func (rw *responseWriter) Size() int {
+	rw.released.check("ResponseWriter")
 	return rw.size
 }
 
 func (rw *responseWriter) Written() bool {
-	return rw.status != 0
+	rw.released.check("ResponseWriter")
+	return rw.status != 0 || rw.hijacked
 }
 
 func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	rw.released.check("ResponseWriter")
 	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
 	if !ok {
 		return nil, nil, fmt.Errorf("the ResponseWriter doesn't support the Hijacker interface")
 	}
-	return hijacker.Hijack()
+	conn, brw, err := hijacker.Hijack()
+	if err == nil {
+		rw.hijacked = true
+	}
+	return conn, brw, err
+}
+
+// Unwrap returns the original ResponseWriter for http.ResponseController
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	rw.released.check("ResponseWriter")
+	return rw.ResponseWriter
 }
 
 func (rw *responseWriter) CloseNotify() <-chan bool {
+	rw.released.check("ResponseWriter")
 	return rw.ResponseWriter.(http.CloseNotifier).CloseNotify()
 }
 
 func (rw *responseWriter) Flush() {
+	rw.released.check("ResponseWriter")
 	flusher, ok := rw.ResponseWriter.(http.Flusher)
 	if ok {
 		flusher.Flush()
 	}
 }
+
+// detachedResponseWriter is the ResponseWriter of a detached Context, it
+// remembers the state of the original response and refuses any write.
+type detachedResponseWriter struct {
+	header http.Header
+	status int
+	size   int
+}
+
+func (rw *detachedResponseWriter) Header() http.Header {
+	return rw.header
+}
+
+func (rw *detachedResponseWriter) WriteHeader(int) {}
+
+func (rw *detachedResponseWriter) Write([]byte) (int, error) {
+	return 0, ErrDetached
+}
+
+func (rw *detachedResponseWriter) Status() int {
+	return rw.status
+}
+
+func (rw *detachedResponseWriter) Size() int {
+	return rw.size
+}
+
+func (rw *detachedResponseWriter) Written() bool {
+	return true
+}
+
+func (rw *detachedResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, ErrDetached
+}
+
+func (rw *detachedResponseWriter) Flush() {}
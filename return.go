@@ -22,6 +22,8 @@ const (
 	autoResponse = iota
 	jsonResponse
 	xmlResponse
+	htmlResponse
+	ndjsonResponse
 )
 
 // ResponseTyper describes reponse type
@@ -63,6 +65,15 @@ func (XML) ResponseType() int {
 	return xmlResponse
 }
 
+// HTML describes return HTML type, the string results are written as HTML
+// and the templates results are rendered by Tango.Renderer
+type HTML struct{}
+
+// ResponseType implementes ResponseTyper
+func (HTML) ResponseType() int {
+	return htmlResponse
+}
+
 func isNil(a interface{}) bool {
 	if a == nil {
 		return true
@@ -83,7 +94,10 @@ type XMLString struct {
 	Content string   `xml:"content"`
 }
 
-// Return returns a tango middleware to handler return values
+// Return returns a tango middleware to handler return values. The channel
+// results are not read any more once the client disconnects, so the
+// goroutine sending to them should also select on the Done channel of the
+// request.
 func Return() HandlerFunc {
 	return func(ctx *Context) {
 		var rt int
@@ -114,6 +128,13 @@ func Return() HandlerFunc {
 			result = res.Result
 		}
 
+		if streamResult(ctx, rt, statusCode, result) {
+			return
+		}
+		if rt == ndjsonResponse {
+			rt = jsonResponse
+		}
+
 		if rt == jsonResponse {
 			encoder := json.NewEncoder(ctx)
 			if len(ctx.Header().Get("Content-Type")) <= 0 {
@@ -231,9 +252,24 @@ func Return() HandlerFunc {
 			return
 		}
 
+		if rt == htmlResponse && len(ctx.Header().Get("Content-Type")) <= 0 {
+			switch result.(type) {
+			case string, []byte:
+				ctx.Header().Set("Content-Type", "text/html; charset=UTF-8")
+			}
+		}
+
 		switch res := result.(type) {
 		case AbortError, error:
 			ctx.HandleError()
+		case *TemplateResult:
+			if statusCode == 0 {
+				statusCode = http.StatusOK
+			}
+			if err := ctx.render(statusCode, res.Name, res.Data); err != nil {
+				ctx.Result = InternalServerError(err.Error())
+				ctx.HandleError()
+			}
 		case []byte:
 			if statusCode == 0 {
 				statusCode = http.StatusOK
@@ -47,6 +47,7 @@ type Route struct {
 	handlers  []Handler
 	routeType RouteType
 	pool      *pool
+	pattern   string
 }
 
 // NewRoute returns a route
@@ -80,6 +81,11 @@ func (r *Route) RouteType() RouteType {
 	return r.routeType
 }
 
+// Pattern returns the path pattern of the route, e.g. /users/:id
+func (r *Route) Pattern() string {
+	return r.pattern
+}
+
 // IsStruct returns if the execute is a struct
 func (r *Route) IsStruct() bool {
 	return r.routeType == StructRoute || r.routeType == StructPtrRoute
@@ -294,6 +300,7 @@ func (r *router) addRoute(method, path string, h *Route) {
 	nodes := parseNodes(path)
 	nodes[len(nodes)-1].handle = h
 	nodes[len(nodes)-1].path = path
+	h.pattern = path
 	if !validNodes(nodes) {
 		panic(fmt.Sprintln("express", path, "is not supported"))
 	}
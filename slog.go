@@ -0,0 +1,84 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tango
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// SlogLogger adapts a log/slog logger to FieldLogger
+type SlogLogger struct {
+	*slog.Logger
+}
+
+// NewSlogLogger returns a FieldLogger writing to l, it could be passed to
+// NewWithLog or Classic
+func NewSlogLogger(l *slog.Logger) *SlogLogger {
+	return &SlogLogger{l}
+}
+
+func slogLevel(level LogLevel) slog.Level {
+	switch level {
+	case LevelDebug:
+		return slog.LevelDebug
+	case LevelInfo:
+		return slog.LevelInfo
+	case LevelWarn:
+		return slog.LevelWarn
+	}
+	return slog.LevelError
+}
+
+// Log implementes FieldLogger
+func (l *SlogLogger) Log(level LogLevel, msg string, keyvals ...interface{}) {
+	l.Logger.Log(context.Background(), slogLevel(level), msg, keyvals...)
+}
+
+// With implementes FieldLogger
+func (l *SlogLogger) With(keyvals ...interface{}) FieldLogger {
+	return &SlogLogger{l.Logger.With(keyvals...)}
+}
+
+// Debugf implementes Logger interface
+func (l *SlogLogger) Debugf(format string, v ...interface{}) {
+	l.Logger.Debug(fmt.Sprintf(format, v...))
+}
+
+// Debug implementes Logger interface
+func (l *SlogLogger) Debug(v ...interface{}) {
+	l.Logger.Debug(sprint(v))
+}
+
+// Infof implementes Logger interface
+func (l *SlogLogger) Infof(format string, v ...interface{}) {
+	l.Logger.Info(fmt.Sprintf(format, v...))
+}
+
+// Info implementes Logger interface
+func (l *SlogLogger) Info(v ...interface{}) {
+	l.Logger.Info(sprint(v))
+}
+
+// Warnf implementes Logger interface
+func (l *SlogLogger) Warnf(format string, v ...interface{}) {
+	l.Logger.Warn(fmt.Sprintf(format, v...))
+}
+
+// Warn implementes Logger interface
+func (l *SlogLogger) Warn(v ...interface{}) {
+	l.Logger.Warn(sprint(v))
+}
+
+// Errorf implementes Logger interface
+func (l *SlogLogger) Errorf(format string, v ...interface{}) {
+	l.Logger.Error(fmt.Sprintf(format, v...))
+}
+
+// Error implementes Logger interface
+func (l *SlogLogger) Error(v ...interface{}) {
+	l.Logger.Error(sprint(v))
+}
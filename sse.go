@@ -0,0 +1,180 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tango
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HeaderLastEventID is the header sent by the browser when reconnecting
+const HeaderLastEventID = "Last-Event-ID"
+
+// ErrStreamClosed is returned when writing to a closed event stream
+var ErrStreamClosed = errors.New("tango: event stream is closed")
+
+// SSEStream is a Server-Sent Events stream, it's safe for concurrent use
+type SSEStream struct {
+	w           ResponseWriter
+	lastEventID string
+
+	lock   sync.Mutex
+	closed bool
+	done   chan struct{}
+}
+
+// SSE starts a Server-Sent Events stream on the response. The stream is
+// closed automatically when the client disconnects or when the request ends,
+// so the action should block until Done is closed.
+func (ctx *Context) SSE() (*SSEStream, error) {
+	if ctx.stream != nil {
+		return ctx.stream, nil
+	}
+	if ctx.Written() {
+		return nil, errors.New("tango: response has been written before starting the event stream")
+	}
+
+	header := ctx.Header()
+	header.Set(HeaderContentType, "text/event-stream; charset=UTF-8")
+	header.Set("Cache-Control", "no-cache")
+	// disable the buffering of nginx
+	header.Set("X-Accel-Buffering", "no")
+	header.Del(HeaderContentLength)
+	ctx.WriteHeader(http.StatusOK)
+	ctx.Flush()
+
+	s := &SSEStream{
+		w:           ctx.ResponseWriter,
+		lastEventID: ctx.Req().Header.Get(HeaderLastEventID),
+		done:        make(chan struct{}),
+	}
+	ctx.stream = s
+
+	go func(reqDone <-chan struct{}) {
+		select {
+		case <-reqDone:
+			s.Close()
+		case <-s.done:
+		}
+	}(ctx.Req().Context().Done())
+
+	return s, nil
+}
+
+// LastEventID returns the Last-Event-ID header sent by a reconnecting client,
+// so that the stream could be resumed after this event.
+func (s *SSEStream) LastEventID() string {
+	return s.lastEventID
+}
+
+// Done returns a channel which is closed when the stream is closed
+func (s *SSEStream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Close closes the stream, nothing will be written after it returns
+func (s *SSEStream) Close() {
+	s.lock.Lock()
+	s.close()
+	s.lock.Unlock()
+}
+
+func (s *SSEStream) close() {
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+	}
+}
+
+func (s *SSEStream) write(b []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return ErrStreamClosed
+	}
+	if _, err := s.w.Write(b); err != nil {
+		// the client has gone
+		s.close()
+		return err
+	}
+	s.w.Flush()
+	return nil
+}
+
+// Send sends an event to the client. event and id could be blank. If data is
+// not a string or []byte, it will be marshaled as JSON.
+func (s *SSEStream) Send(event, id string, data interface{}) error {
+	var content string
+	switch d := data.(type) {
+	case string:
+		content = d
+	case []byte:
+		content = string(d)
+	default:
+		bs, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		content = string(bs)
+	}
+
+	var buf bytes.Buffer
+	if id != "" {
+		buf.WriteString("id: " + stripNewlines(id) + "\n")
+	}
+	if event != "" {
+		buf.WriteString("event: " + stripNewlines(event) + "\n")
+	}
+	// \r\n, \r and \n are all line terminators of SSE
+	for _, line := range strings.Split(sseNewlines.Replace(content), "\n") {
+		buf.WriteString("data: " + line + "\n")
+	}
+	buf.WriteString("\n")
+	return s.write(buf.Bytes())
+}
+
+// Retry tells the client how long to wait before reconnecting
+func (s *SSEStream) Retry(d time.Duration) error {
+	return s.write([]byte("retry: " + strconv.FormatInt(int64(d/time.Millisecond), 10) + "\n\n"))
+}
+
+// Comment sends a comment line which is ignored by the client
+func (s *SSEStream) Comment(text string) error {
+	return s.write([]byte(": " + stripNewlines(text) + "\n\n"))
+}
+
+// Heartbeat sends a comment every interval to keep the connection alive
+// through proxies, until the stream is closed.
+func (s *SSEStream) Heartbeat(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if s.Comment("heartbeat") != nil {
+					return
+				}
+			case <-s.done:
+				return
+			}
+		}
+	}()
+}
+
+// sseNewlines replaces the line terminators by \n
+var sseNewlines = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+// stripNewlines removes the line terminators of a single line field, e.g.
+// the id and the event
+func stripNewlines(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
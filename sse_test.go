@@ -0,0 +1,162 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tango
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type SSEAction struct {
+	Ctx
+}
+
+func (a *SSEAction) Get() error {
+	stream, err := a.SSE()
+	if err != nil {
+		return err
+	}
+	stream.Retry(3 * time.Second)
+	stream.Send("", "", "hello\nworld")
+	stream.Send("resume", stream.LastEventID(), map[string]int{"count": 1})
+	return nil
+}
+
+type SSEGZipAction struct {
+	GZip
+	SSEAction
+}
+
+func TestSSE(t *testing.T) {
+	buff := bytes.NewBufferString("")
+	recorder := httptest.NewRecorder()
+	recorder.Body = buff
+
+	o := Classic()
+	o.Get("/", new(SSEAction))
+
+	req, err := http.NewRequest("GET", "http://localhost:8000/", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	req.Header.Set(HeaderLastEventID, "5")
+
+	o.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, recorder.Header().Get("Content-Type"), "text/event-stream; charset=UTF-8")
+	expect(t, recorder.Header().Get("Cache-Control"), "no-cache")
+	expect(t, recorder.Flushed, true)
+	expect(t, buff.String(), "retry: 3000\n\ndata: hello\ndata: world\n\nid: 5\nevent: resume\ndata: {\"count\":1}\n\n")
+}
+
+func TestSSENewlines(t *testing.T) {
+	buff := bytes.NewBufferString("")
+	recorder := httptest.NewRecorder()
+	recorder.Body = buff
+
+	o := Classic()
+	o.Get("/", func(ctx *Context) error {
+		stream, err := ctx.SSE()
+		if err != nil {
+			return err
+		}
+		stream.Send("", "", "hello\revent: admin\rdata: pwned")
+		stream.Send("a\rb\nc", "1\r\n2", "x\r\ny\n\rz")
+		return nil
+	})
+
+	req, err := http.NewRequest("GET", "http://localhost:8000/", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	o.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, buff.String(), "data: hello\ndata: event: admin\ndata: data: pwned\n\n"+
+		"id: 12\nevent: abc\ndata: x\ndata: y\ndata: \ndata: z\n\n")
+}
+
+func TestSSEGZip(t *testing.T) {
+	buff := bytes.NewBufferString("")
+	recorder := httptest.NewRecorder()
+	recorder.Body = buff
+
+	o := Classic()
+	o.Get("/", new(SSEGZipAction))
+
+	req, err := http.NewRequest("GET", "http://localhost:8000/", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	req.Header.Set(HeaderAcceptEncoding, "gzip")
+
+	o.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, recorder.Header().Get(HeaderContentEncoding), "gzip")
+	expect(t, recorder.Header().Get("Content-Type"), "text/event-stream; charset=UTF-8")
+
+	r, err := gzip.NewReader(buff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, string(content), "retry: 3000\n\ndata: hello\ndata: world\n\nevent: resume\ndata: {\"count\":1}\n\n")
+}
+
+func TestSSEStreaming(t *testing.T) {
+	closed := make(chan struct{})
+	o := Classic()
+	o.Get("/", func(ctx *Context) {
+		stream, err := ctx.SSE()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		stream.Heartbeat(10 * time.Millisecond)
+		stream.Send("tick", "1", "first")
+		<-stream.Done()
+		expect(t, stream.Send("tick", "2", "second"), ErrStreamClosed)
+		close(closed)
+	})
+
+	srv := httptest.NewServer(o)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(resp.Body)
+	expect(t, readLine(t, reader), "id: 1")
+	expect(t, readLine(t, reader), "event: tick")
+	expect(t, readLine(t, reader), "data: first")
+	expect(t, readLine(t, reader), "")
+	expect(t, readLine(t, reader), ": heartbeat")
+
+	// disconnect the client
+	resp.Body.Close()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Error("the stream is not closed after the client disconnected")
+	}
+}
+
+func readLine(t *testing.T, r *bufio.Reader) string {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	return line[:len(line)-1]
+}
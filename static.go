@@ -5,11 +5,17 @@
 package tango
 
 import (
+	"html/template"
+	"io"
+	"io/fs"
+	"mime"
 	"net/http"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 )
 
 // StaticOptions defines Static middleware's options
@@ -17,10 +23,337 @@ type StaticOptions struct {
 	RootPath   string
 	Prefix     string
 	IndexFiles []string
-	ListDir    bool
-	FilterExts []string
+	// ListDir lists the files of the directories without index files, as
+	// JSON if the client accepts application/json. The files are sorted by
+	// the query parameters sort, one of name, size, modtime and type, and
+	// order, asc or desc.
+	ListDir bool
+	// ListTemplate renders the DirList of the directories, default is
+	// DefaultDirListTemplate
+	ListTemplate *template.Template
+	FilterExts   []string
 	// FileSystem is the interface for supporting any implmentation of file system.
 	FileSystem http.FileSystem
+	// FS serves the files of an fs.FS, e.g. an embed.FS, instead of RootPath
+	// if FileSystem is nil
+	FS fs.FS
+	// ModTime is the modification time of the files of FS which have none,
+	// e.g. the build time. The files without modtime are always served with
+	// an ETag of their content.
+	ModTime time.Time
+	// Precompressed serves the .br, .zst or .gz sibling of a file, e.g. app.js.br
+	// for app.js, if the client accepts its encoding
+	Precompressed bool
+	// ETag sends a strong ETag computed from the file content, the hashes
+	// are cached until the files are modified
+	ETag bool
+	// CacheRules set the Cache-Control and Expires headers of the files,
+	// the first matching rule is applied
+	CacheRules []CacheRule
+	// Immutable caches the fingerprinted files, e.g. app.3f9a1c.js, for a
+	// year as immutable if no rule matches them
+	Immutable bool
+	// Manifest, if set, limits Immutable to the fingerprinted names of the
+	// manifest instead of the names which look like having a hash
+	Manifest *Manifest
+	// Fallback is the file served instead of the missing files to the HTML
+	// navigations, e.g. "index.html" for a single page application. The
+	// requests for the other file extensions, not accepting text/html, or
+	// matching a route are not affected.
+	Fallback string
+	// FallbackExcludes are the URL path prefixes never served the Fallback,
+	// e.g. "/app/api"
+	FallbackExcludes []string
+	// MemoryCache serves the small files from memory with precomputed ETags
+	// if its Size is positive
+	MemoryCache MemoryCacheOptions
+	// DotFiles is the policy of the dotfiles, they are ignored by default
+	// and never listed unless allowed
+	DotFiles DotFiles
+	// FollowSymlinks serves the symbolic links pointing outside of RootPath
+	// or an http.Dir, they are refused by default
+	FollowSymlinks bool
+
+	// root is the directory of the files to check the symbolic links
+	root *rootDir
+}
+
+// CacheRule defines the cache headers of the matched static files
+type CacheRule struct {
+	// Pattern matches the file path as path.Match, e.g. "/images/*.png",
+	// a pattern without "/" matches the file name, e.g. "*.css"
+	Pattern string
+	// CacheControl is the Cache-Control header, e.g. "public, max-age=3600"
+	CacheControl string
+	// Expires sets the Expires header to the time after the duration
+	Expires time.Duration
+}
+
+func (r *CacheRule) match(name string) bool {
+	if !strings.Contains(r.Pattern, "/") {
+		name = path.Base(name)
+	}
+	ok, _ := path.Match(r.Pattern, name)
+	return ok
+}
+
+// immutableCacheControl is the Cache-Control of the fingerprinted files
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
+// IsFingerprinted returns true if the file name contains a content hash of
+// 6 to 64 lowercase hex characters, e.g. app.3f9a1c.js or app.3f9a1c.min.js.
+// The words made of hex letters, e.g. ui.facade.js, are matched too, set
+// StaticOptions.Manifest to only match the names of the build.
+func IsFingerprinted(name string) bool {
+	_, ok := removeFingerprint(path.Base(name))
+	return ok
+}
+
+// removeFingerprint returns the file name without its content hash, e.g.
+// app.min.js for app.3f9a1c.min.js
+func removeFingerprint(base string) (string, bool) {
+	parts := strings.Split(base, ".")
+	for i := 1; i < len(parts)-1; i++ {
+		if isContentHash(parts[i]) {
+			return strings.Join(append(parts[:i:i], parts[i+1:]...), "."), true
+		}
+	}
+	return base, false
+}
+
+func isContentHash(s string) bool {
+	if len(s) < 6 || len(s) > 64 {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *StaticOptions) isFingerprinted(name string) bool {
+	if s.Manifest != nil {
+		return s.Manifest.IsFingerprinted(name)
+	}
+	return IsFingerprinted(name)
+}
+
+// setCacheHeaders sets the cache headers of the file name
+func (s *StaticOptions) setCacheHeaders(ctx *Context, name string) {
+	header := ctx.Header()
+	for i := range s.CacheRules {
+		rule := &s.CacheRules[i]
+		if !rule.match("/" + name) {
+			continue
+		}
+		if rule.CacheControl != "" {
+			header.Set("Cache-Control", rule.CacheControl)
+		}
+		if rule.Expires != 0 {
+			header.Set("Expires", time.Now().Add(rule.Expires).UTC().Format(http.TimeFormat))
+		}
+		return
+	}
+	if s.Immutable && s.isFingerprinted(name) {
+		header.Set("Cache-Control", immutableCacheControl)
+	}
+}
+
+type etagEntry struct {
+	modTime time.Time
+	size    int64
+	etag    string
+}
+
+// etagCache caches the ETags of the files until they are modified
+type etagCache struct {
+	lock  sync.RWMutex
+	etags map[string]etagEntry
+}
+
+func newETagCache() *etagCache {
+	return &etagCache{etags: make(map[string]etagEntry)}
+}
+
+// get returns the ETag of the file name, f is read from the beginning
+// and rewound if the hash is not cached. A nil cache always hashes f.
+func (c *etagCache) get(name string, info os.FileInfo, f io.ReadSeeker) (string, error) {
+	if c == nil {
+		return hashETag(f)
+	}
+
+	c.lock.RLock()
+	entry, ok := c.etags[name]
+	c.lock.RUnlock()
+	if ok && entry.modTime.Equal(info.ModTime()) && entry.size == info.Size() {
+		return entry.etag, nil
+	}
+
+	etag, err := hashETag(f)
+	if err != nil {
+		return "", err
+	}
+
+	c.lock.Lock()
+	c.etags[name] = etagEntry{info.ModTime(), info.Size(), etag}
+	c.lock.Unlock()
+	return etag, nil
+}
+
+// precompressedExts are the extensions of the precompressed files in the
+// order of preference
+var precompressedExts = []struct {
+	encoding, ext string
+}{
+	{"br", ".br"},
+	{"zstd", ".zst"},
+	{"gzip", ".gz"},
+}
+
+// addVary adds the value to the Vary header if it's not there
+func addVary(header http.Header, value string) {
+	for _, v := range header.Values(HeaderVary) {
+		for _, s := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(s), value) {
+				return
+			}
+		}
+	}
+	header.Add(HeaderVary, value)
+}
+
+// openPrecompressed returns the precompressed sibling of the file name with
+// the best encoding accepted by the request
+func openPrecompressed(ctx *Context, fileSystem http.FileSystem, name string) (http.File, os.FileInfo, string) {
+	ae := ctx.Req().Header.Get(HeaderAcceptEncoding)
+	if ae == "" {
+		return nil, nil, ""
+	}
+
+	var best http.File
+	var bestInfo os.FileInfo
+	var bestEncoding string
+	var bestQ float64
+	for _, pre := range precompressedExts {
+		q := acceptEncoding(ae, pre.encoding)
+		if q <= bestQ {
+			continue
+		}
+		f, err := fileSystem.Open(name + pre.ext)
+		if err != nil {
+			continue
+		}
+		info, err := f.Stat()
+		if err != nil || info.IsDir() {
+			f.Close()
+			continue
+		}
+		if best != nil {
+			best.Close()
+		}
+		best, bestInfo, bestEncoding, bestQ = f, info, pre.encoding, q
+	}
+	return best, bestInfo, bestEncoding
+}
+
+// serveContent serves the content of the file name, with the ETag if etag
+// is true or the file has no modtime
+func serveContent(ctx *Context, etags *etagCache, etag bool, name string, info os.FileInfo, f http.File) {
+	if mf, ok := f.(*memFile); ok {
+		ctx.Header().Set("ETag", mf.entry.etag)
+	} else if etag || info.ModTime().IsZero() {
+		tag, err := etags.get(name, info, f)
+		if err != nil {
+			ctx.Result = InternalServerError(err.Error())
+			ctx.HandleError()
+			return
+		}
+		ctx.Header().Set("ETag", tag)
+	}
+	http.ServeContent(ctx, ctx.Req(), info.Name(), info.ModTime(), f)
+}
+
+// serveFile serves the file, or its precompressed sibling
+func serveFile(ctx *Context, opt *StaticOptions, etags *etagCache, name string, finfo os.FileInfo, f http.File) {
+	opt.setCacheHeaders(ctx, name)
+	if opt.Precompressed {
+		addVary(ctx.Header(), HeaderAcceptEncoding)
+		if cf, cinfo, encoding := openPrecompressed(ctx, opt.FileSystem, name); cf != nil {
+			defer cf.Close()
+
+			// the content type of the original file
+			ctype := mime.TypeByExtension(path.Ext(finfo.Name()))
+			if ctype == "" {
+				var buf [512]byte
+				n, _ := io.ReadFull(f, buf[:])
+				ctype = http.DetectContentType(buf[:n])
+			}
+			if len(ctx.Header().Get(HeaderContentType)) == 0 {
+				ctx.Header().Set(HeaderContentType, ctype)
+			}
+			ctx.Header().Set(HeaderContentEncoding, encoding)
+			serveContent(ctx, etags, opt.ETag, name+"."+encoding, cinfo, cf)
+			return
+		}
+	}
+
+	serveContent(ctx, etags, opt.ETag, name, finfo, f)
+}
+
+// wantsFallback returns true if the Fallback should be served to the request
+// of the missing file
+func (s *StaticOptions) wantsFallback(ctx *Context) bool {
+	if s.Fallback == "" {
+		return false
+	}
+	req := ctx.Req()
+	for _, prefix := range s.FallbackExcludes {
+		if strings.HasPrefix(req.URL.Path, prefix) {
+			return false
+		}
+	}
+	switch strings.ToLower(path.Ext(req.URL.Path)) {
+	case "", ".html", ".htm":
+	default:
+		return false
+	}
+
+	addVary(ctx.Header(), "Accept")
+	if !strings.Contains(req.Header.Get("Accept"), "text/html") {
+		return false
+	}
+	return ctx.Route() == nil
+}
+
+// serveFallback serves the Fallback file
+func serveFallback(ctx *Context, opt *StaticOptions, etags *etagCache) {
+	name := strings.TrimLeft(opt.Fallback, "/")
+	f, err := opt.FileSystem.Open(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			ctx.Result = NotFound()
+		} else {
+			ctx.Result = InternalServerError(err.Error())
+		}
+		ctx.HandleError()
+		return
+	}
+	defer f.Close()
+
+	finfo, err := f.Stat()
+	if err != nil {
+		ctx.Result = InternalServerError(err.Error())
+		ctx.HandleError()
+		return
+	}
+	if finfo.IsDir() {
+		ctx.Result = NotFound()
+		ctx.HandleError()
+		return
+	}
+	serveFile(ctx, opt, etags, name, finfo, f)
 }
 
 // IsFilterExt decribes if rPath's ext match filter ext
@@ -55,24 +388,45 @@ func prepareStaticOptions(options []StaticOptions) StaticOptions {
 		opt.IndexFiles = []string{"index.html", "index.htm"}
 	}
 
+	if opt.FileSystem == nil && opt.FS != nil {
+		fsys := opt.FS
+		if !opt.ModTime.IsZero() {
+			fsys = ModTimeFS(fsys, opt.ModTime)
+		}
+		opt.FileSystem = FS(fsys)
+	}
+
 	if opt.FileSystem == nil {
 		ps, _ := filepath.Abs(opt.RootPath)
 		opt.FileSystem = http.Dir(ps)
 	}
 
+	if dir, ok := opt.FileSystem.(http.Dir); ok {
+		opt.root = newRootDir(string(dir))
+	}
+
+	if opt.MemoryCache.Size > 0 {
+		opt.FileSystem = newMemCache(opt.FileSystem, opt.MemoryCache)
+	}
+
 	return opt
 }
 
-// Static return a middleware for serving static files
+// Static return a middleware for serving static files, the options are
+// prepared once
 func Static(opts ...StaticOptions) HandlerFunc {
+	opt := prepareStaticOptions(opts)
+	var etags *etagCache
+	if opt.ETag || opt.FS != nil {
+		etags = newETagCache()
+	}
+
 	return func(ctx *Context) {
 		if ctx.Req().Method != "GET" && ctx.Req().Method != "HEAD" {
 			ctx.Next()
 			return
 		}
 
-		opt := prepareStaticOptions(opts)
-
 		var rPath = ctx.Req().URL.Path
 		// if defined prefix, then only check prefix
 		if opt.Prefix != "" {
@@ -88,15 +442,32 @@ func Static(opts ...StaticOptions) HandlerFunc {
 			}
 		}
 
-		f, err := opt.FileSystem.Open(strings.TrimLeft(rPath, "/"))
+		name := strings.TrimLeft(rPath, "/")
+		policy := FileOptions{opt.DotFiles, opt.FollowSymlinks}
+		root := opt.root
+		if cache, ok := opt.FileSystem.(*memCache); ok && cache.has(name) {
+			// the links were checked before caching the file
+			root = nil
+		}
+		var f http.File
+		err := policy.checkPath(ctx, root, rPath)
+		if err == nil {
+			f, err = opt.FileSystem.Open(name)
+		}
 		if err != nil {
 			if os.IsNotExist(err) {
+				if opt.wantsFallback(ctx) {
+					serveFallback(ctx, &opt, etags)
+					return
+				}
 				if opt.Prefix != "" {
 					ctx.Result = NotFound()
 				} else {
 					ctx.Next()
 					return
 				}
+			} else if os.IsPermission(err) {
+				ctx.Result = Forbidden()
 			} else {
 				ctx.Result = InternalServerError(err.Error())
 			}
@@ -118,14 +489,18 @@ func Static(opts ...StaticOptions) HandlerFunc {
 				return
 			}
 
-			http.ServeContent(ctx, ctx.Req(), finfo.Name(), finfo.ModTime(), f)
+			serveFile(ctx, &opt, etags, name, finfo, f)
 			return
 		}
 
 		// try serving index.html or index.htm
 		if len(opt.IndexFiles) > 0 {
 			for _, index := range opt.IndexFiles {
-				fi, err := opt.FileSystem.Open(strings.TrimLeft(path.Join(rPath, index), "/"))
+				indexName := strings.TrimLeft(path.Join(rPath, index), "/")
+				if policy.checkPath(ctx, opt.root, indexName) != nil {
+					continue
+				}
+				fi, err := opt.FileSystem.Open(indexName)
 				if err != nil {
 					if !os.IsNotExist(err) {
 						ctx.Result = InternalServerError(err.Error())
@@ -141,7 +516,7 @@ func Static(opts ...StaticOptions) HandlerFunc {
 						return
 					}
 					if !finfo.IsDir() {
-						http.ServeContent(ctx, ctx.Req(), finfo.Name(), finfo.ModTime(), fi)
+						serveFile(ctx, &opt, etags, indexName, finfo, fi)
 						fi.Close()
 						return
 					}
@@ -152,31 +527,7 @@ func Static(opts ...StaticOptions) HandlerFunc {
 
 		// list dir files
 		if opt.ListDir {
-			ctx.Header().Set("Content-Type", "text/html; charset=UTF-8")
-			ctx.WriteString(`<ul style="list-style-type:none;line-height:32px;">`)
-			if rPath != "/" {
-				ctx.WriteString(`<li>&nbsp; &nbsp; <a href="` + path.Join("/", opt.Prefix, filepath.Dir(rPath)) + `">..</a></li>`)
-			}
-
-			fs, err := f.Readdir(0)
-			if err != nil {
-				ctx.Result = InternalServerError(err.Error())
-				ctx.HandleError()
-				return
-			}
-
-			for _, fi := range fs {
-				if fi.IsDir() {
-					ctx.WriteString(`<li>┖ <a href="` + path.Join("/", opt.Prefix, rPath, fi.Name()) + `">` + path.Base(fi.Name()) + `</a></li>`)
-				} else {
-					if len(opt.FilterExts) > 0 && !opt.IsFilterExt(fi.Name()) {
-						continue
-					}
-
-					ctx.WriteString(`<li>&nbsp; &nbsp; <a href="` + path.Join("/", opt.Prefix, rPath, fi.Name()) + `">` + filepath.Base(fi.Name()) + `</a></li>`)
-				}
-			}
-			ctx.WriteString("</ul>")
+			serveDirList(ctx, &opt, rPath, f)
 			return
 		}
 
@@ -0,0 +1,263 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tango
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// MemoryCacheOptions defines the options of the in-memory cache of the
+// static files
+type MemoryCacheOptions struct {
+	// Size is the memory budget of the cached files in bytes, the least
+	// recently used files are evicted first. Zero disables the cache.
+	Size int64
+	// MaxFileSize is the maximum size of a cached file, default is 256KB
+	MaxFileSize int64
+	// CheckInterval is the interval to check the modtime of a cached file
+	// before serving it, default is one second
+	CheckInterval time.Duration
+	// Watch invalidates the cached files by inotify instead of checking
+	// their modtime. It's only supported on Linux for the files of RootPath
+	// or an http.Dir, otherwise the modtime is checked.
+	Watch bool
+	// Context stops watching the files when it's done, e.g. when the server
+	// is shut down, the modtime is checked then. The files are watched until
+	// the process exits by default.
+	Context context.Context
+}
+
+// memEntry is a cached file
+type memEntry struct {
+	name    string
+	data    []byte
+	info    os.FileInfo
+	etag    string
+	checked time.Time
+}
+
+// memFile is an http.File serving a cached file from memory
+type memFile struct {
+	*bytes.Reader
+	entry *memEntry
+}
+
+func (f *memFile) Close() error {
+	return nil
+}
+
+func (f *memFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, errors.New("tango: not a directory")
+}
+
+func (f *memFile) Stat() (os.FileInfo, error) {
+	return f.entry.info, nil
+}
+
+// memCache is an http.FileSystem caching the small files of another one
+type memCache struct {
+	http.FileSystem
+	opt     MemoryCacheOptions
+	watcher fileWatcher
+
+	lock  sync.Mutex
+	used  int64
+	lru   *list.List
+	items map[string]*list.Element
+	// gen is increased on every invalidation, so that a file read before
+	// it is not cached
+	gen uint64
+}
+
+func newMemCache(fileSystem http.FileSystem, opt MemoryCacheOptions) *memCache {
+	if opt.MaxFileSize <= 0 {
+		opt.MaxFileSize = 256 << 10
+	}
+	if opt.CheckInterval <= 0 {
+		opt.CheckInterval = time.Second
+	}
+
+	c := &memCache{
+		FileSystem: fileSystem,
+		opt:        opt,
+		lru:        list.New(),
+		items:      make(map[string]*list.Element),
+	}
+	if opt.Watch {
+		if dir, ok := fileSystem.(http.Dir); ok {
+			root, err := filepath.Abs(string(dir))
+			if err == nil {
+				// fall back to checking the modtime if it fails
+				c.watcher, _ = newFileWatcher(root, c.invalidate)
+			}
+		}
+		if c.watcher != nil && opt.Context != nil {
+			context.AfterFunc(opt.Context, c.stopWatching)
+		}
+	}
+	return c
+}
+
+// stopWatching closes the watcher, the modtime of the cached files is
+// checked then
+func (c *memCache) stopWatching() {
+	c.lock.Lock()
+	watcher := c.watcher
+	c.watcher = nil
+	c.lock.Unlock()
+	if watcher != nil {
+		watcher.close()
+	}
+}
+
+// Open returns the cached file name, or caches it if it's small enough
+func (c *memCache) Open(name string) (http.File, error) {
+	name = path.Clean("/" + name)
+
+	c.lock.Lock()
+	gen := c.gen
+	watcher := c.watcher
+	var entry *memEntry
+	var checked time.Time
+	if elem, ok := c.items[name]; ok {
+		c.lru.MoveToFront(elem)
+		entry = elem.Value.(*memEntry)
+		checked = entry.checked
+	}
+	c.lock.Unlock()
+
+	if entry != nil {
+		if watcher != nil || time.Since(checked) < c.opt.CheckInterval {
+			return &memFile{bytes.NewReader(entry.data), entry}, nil
+		}
+		if c.unchanged(entry) {
+			c.lock.Lock()
+			entry.checked = time.Now()
+			c.lock.Unlock()
+			return &memFile{bytes.NewReader(entry.data), entry}, nil
+		}
+		c.remove(name)
+	}
+
+	// the directory is watched before reading the file, so that no
+	// modification is missed
+	if watcher != nil && watcher.add(path.Dir(name)) != nil {
+		return c.FileSystem.Open(name)
+	}
+
+	f, err := c.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.IsDir() || info.Size() > c.opt.MaxFileSize || info.Size() > c.opt.Size {
+		return f, nil
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	etag, err := hashETag(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	entry = &memEntry{name, data, info, etag, time.Now()}
+	if int64(len(data)) == info.Size() {
+		c.add(entry, gen)
+	}
+	return &memFile{bytes.NewReader(entry.data), entry}, nil
+}
+
+// has returns true if the file name is cached
+func (c *memCache) has(name string) bool {
+	name = path.Clean("/" + name)
+	c.lock.Lock()
+	_, ok := c.items[name]
+	c.lock.Unlock()
+	return ok
+}
+
+// unchanged returns true if the modtime and the size of the cached file
+// are not changed
+func (c *memCache) unchanged(entry *memEntry) bool {
+	f, err := c.FileSystem.Open(entry.name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	return err == nil && info.ModTime().Equal(entry.info.ModTime()) && info.Size() == entry.info.Size()
+}
+
+func (c *memCache) add(entry *memEntry, gen uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.gen != gen {
+		return
+	}
+	if elem, ok := c.items[entry.name]; ok {
+		c.removeElement(elem)
+	}
+	c.items[entry.name] = c.lru.PushFront(entry)
+	c.used += int64(len(entry.data))
+	for c.used > c.opt.Size {
+		c.removeElement(c.lru.Back())
+	}
+}
+
+func (c *memCache) removeElement(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*memEntry)
+	delete(c.items, entry.name)
+	c.used -= int64(len(entry.data))
+}
+
+func (c *memCache) remove(name string) {
+	c.lock.Lock()
+	if elem, ok := c.items[name]; ok {
+		c.removeElement(elem)
+	}
+	c.lock.Unlock()
+}
+
+// invalidate removes the cached file name, an empty name removes all files
+func (c *memCache) invalidate(name string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.gen++
+	if name == "" {
+		c.lru.Init()
+		c.items = make(map[string]*list.Element)
+		c.used = 0
+		return
+	}
+	if elem, ok := c.items[name]; ok {
+		c.removeElement(elem)
+	}
+}
+
+// fileWatcher watches the directories of the cached files
+type fileWatcher interface {
+	// add watches the directory, the slash-separated path relative to
+	// the root
+	add(dir string) error
+	// close stops watching
+	close() error
+}
@@ -0,0 +1,159 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tango
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestStaticMemoryCache(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "a.txt")
+	os.WriteFile(p, []byte("first"), 0644)
+	os.WriteFile(filepath.Join(dir, "big.txt"), []byte("0123456789"), 0644)
+
+	o := New(Static(StaticOptions{
+		RootPath: dir,
+		MemoryCache: MemoryCacheOptions{
+			Size:          16,
+			MaxFileSize:   8,
+			CheckInterval: time.Hour,
+		},
+	}))
+
+	recorder := testStaticRequest(t, o, "/a.txt")
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, recorder.Body.String(), "first")
+	etag := recorder.Header().Get("ETag")
+	expect(t, len(etag), 34)
+
+	// the cached file is served until it's checked
+	os.WriteFile(p, []byte("second"), 0644)
+	recorder = testStaticRequest(t, o, "/a.txt", "If-None-Match", etag)
+	expect(t, recorder.Code, http.StatusNotModified)
+
+	// the files larger than MaxFileSize are not cached
+	recorder = testStaticRequest(t, o, "/big.txt")
+	expect(t, recorder.Body.String(), "0123456789")
+	expect(t, recorder.Header().Get("ETag"), "")
+}
+
+func TestStaticMemoryCacheCheck(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "a.txt")
+	os.WriteFile(p, []byte("first"), 0644)
+
+	o := New(Static(StaticOptions{
+		RootPath:    dir,
+		MemoryCache: MemoryCacheOptions{Size: 1 << 10, CheckInterval: time.Nanosecond},
+	}))
+
+	recorder := testStaticRequest(t, o, "/a.txt")
+	expect(t, recorder.Body.String(), "first")
+
+	os.WriteFile(p, []byte("second"), 0644)
+	os.Chtimes(p, time.Now().Add(time.Hour), time.Now().Add(time.Hour))
+	recorder = testStaticRequest(t, o, "/a.txt")
+	expect(t, recorder.Body.String(), "second")
+}
+
+func TestStaticMemoryCacheWatch(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("inotify is only supported on linux")
+	}
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "js"), os.ModePerm)
+	p := filepath.Join(dir, "js", "a.js")
+	os.WriteFile(p, []byte("first"), 0644)
+
+	o := New(Static(StaticOptions{
+		RootPath:    dir,
+		MemoryCache: MemoryCacheOptions{Size: 1 << 10, CheckInterval: time.Hour, Watch: true},
+	}))
+
+	recorder := testStaticRequest(t, o, "/js/a.js")
+	expect(t, recorder.Body.String(), "first")
+
+	os.WriteFile(p, []byte("second"), 0644)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		recorder = testStaticRequest(t, o, "/js/a.js")
+		if recorder.Body.String() == "second" || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	expect(t, recorder.Body.String(), "second")
+}
+
+func TestMemCacheStopWatching(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("inotify is only supported on linux")
+	}
+
+	dir := t.TempDir()
+	p := filepath.Join(dir, "a.txt")
+	os.WriteFile(p, []byte("first"), 0644)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := newMemCache(http.Dir(dir), MemoryCacheOptions{
+		Size:          1 << 10,
+		CheckInterval: time.Nanosecond,
+		Watch:         true,
+		Context:       ctx,
+	})
+	refute(t, c.watcher, nil)
+	cancel()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		c.lock.Lock()
+		watcher := c.watcher
+		c.lock.Unlock()
+		if watcher == nil || time.Now().After(deadline) {
+			expect(t, watcher, nil)
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the modtime is checked once the watcher is stopped
+	f, err := c.Open("a.txt")
+	expect(t, err, nil)
+	f.Close()
+	os.WriteFile(p, []byte("second"), 0644)
+	os.Chtimes(p, time.Now().Add(time.Hour), time.Now().Add(time.Hour))
+	f, err = c.Open("a.txt")
+	expect(t, err, nil)
+	data := make([]byte, 10)
+	n, _ := f.Read(data)
+	expect(t, string(data[:n]), "second")
+	f.Close()
+}
+
+func TestMemCacheEviction(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a", "b", "c"} {
+		os.WriteFile(filepath.Join(dir, name), []byte("12345"), 0644)
+	}
+
+	c := newMemCache(http.Dir(dir), MemoryCacheOptions{Size: 10, CheckInterval: time.Hour})
+	for _, name := range []string{"a", "b", "a", "c"} {
+		f, err := c.Open(name)
+		expect(t, err, nil)
+		f.Close()
+	}
+	// b is the least recently used
+	expect(t, c.used, int64(10))
+	expect(t, len(c.items), 2)
+	_, ok := c.items["/b"]
+	expect(t, ok, false)
+}
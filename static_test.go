@@ -6,14 +6,29 @@ package tango
 
 import (
 	"bytes"
+	"embed"
 	"encoding/json"
+	"io/fs"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
 
+//go:embed public
+var testPublicFS embed.FS
+
+func testPublicSub(t *testing.T) fs.FS {
+	sub, err := fs.Sub(testPublicFS, "public")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sub
+}
+
 func TestStatic(t *testing.T) {
 	buff := bytes.NewBufferString("")
 	recorder := httptest.NewRecorder()
@@ -311,3 +326,224 @@ func TestStatic8(t *testing.T) {
 	expect(t, recorder.Code, http.StatusOK)
 	expect(t, buff.String(), "hello")
 }
+
+func testStaticRequest(t *testing.T, o *Tango, url string, headers ...string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest("GET", "http://localhost:8000"+url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	recorder := httptest.NewRecorder()
+	o.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestStaticPrecompressed(t *testing.T) {
+	dir := t.TempDir()
+	js := strings.Repeat("console.log('tango');\n", 10)
+	os.WriteFile(filepath.Join(dir, "app.js"), []byte(js), 0644)
+	os.WriteFile(filepath.Join(dir, "app.js.gz"), gzipBytes([]byte(js)), 0644)
+	os.WriteFile(filepath.Join(dir, "app.js.br"), []byte("brotli content"), 0644)
+	os.WriteFile(filepath.Join(dir, "noext"), []byte("<html><body>noext</body></html>"), 0644)
+	os.WriteFile(filepath.Join(dir, "noext.gz"), gzipBytes([]byte("<html><body>noext</body></html>")), 0644)
+
+	o := New(Compresses([]string{".js"}), Static(StaticOptions{
+		RootPath:      dir,
+		Precompressed: true,
+	}))
+
+	recorder := testStaticRequest(t, o, "/app.js", HeaderAcceptEncoding, "gzip, br")
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, recorder.Header().Get(HeaderContentEncoding), "br")
+	expect(t, recorder.Header().Get(HeaderContentType), "text/javascript; charset=utf-8")
+	expect(t, strings.Join(recorder.Header().Values(HeaderVary), ","), HeaderAcceptEncoding)
+	expect(t, recorder.Body.String(), "brotli content")
+
+	recorder = testStaticRequest(t, o, "/app.js", HeaderAcceptEncoding, "br;q=0.5, gzip")
+	expect(t, recorder.Header().Get(HeaderContentEncoding), "gzip")
+	expect(t, gunzip(t, recorder.Body.Bytes()), js)
+
+	recorder = testStaticRequest(t, o, "/app.js", HeaderAcceptEncoding, "br", "Range", "bytes=0-5")
+	expect(t, recorder.Code, http.StatusPartialContent)
+	expect(t, recorder.Header().Get(HeaderContentEncoding), "br")
+	expect(t, recorder.Body.String(), "brotli")
+
+	// compressed on the fly
+	recorder = testStaticRequest(t, o, "/app.js", HeaderAcceptEncoding, "deflate")
+	expect(t, recorder.Header().Get(HeaderContentEncoding), "deflate")
+	expect(t, strings.Join(recorder.Header().Values(HeaderVary), ","), HeaderAcceptEncoding)
+
+	recorder = testStaticRequest(t, o, "/app.js")
+	expect(t, recorder.Header().Get(HeaderContentEncoding), "")
+	expect(t, recorder.Header().Get(HeaderVary), HeaderAcceptEncoding)
+	expect(t, recorder.Body.String(), js)
+
+	// the content type is sniffed from the original file
+	recorder = testStaticRequest(t, o, "/noext", HeaderAcceptEncoding, "gzip")
+	expect(t, recorder.Header().Get(HeaderContentEncoding), "gzip")
+	expect(t, recorder.Header().Get(HeaderContentType), "text/html; charset=utf-8")
+}
+
+func TestStaticETag(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "a.txt")
+	os.WriteFile(p, []byte("first"), 0644)
+
+	o := New(Static(StaticOptions{RootPath: dir, ETag: true}))
+
+	recorder := testStaticRequest(t, o, "/a.txt")
+	expect(t, recorder.Code, http.StatusOK)
+	etag := recorder.Header().Get("ETag")
+	expect(t, len(etag), 34)
+	expect(t, recorder.Body.String(), "first")
+
+	recorder = testStaticRequest(t, o, "/a.txt", "If-None-Match", etag)
+	expect(t, recorder.Code, http.StatusNotModified)
+
+	// the cached hash is invalidated by the new modtime
+	os.WriteFile(p, []byte("second"), 0644)
+	os.Chtimes(p, time.Now().Add(time.Hour), time.Now().Add(time.Hour))
+	recorder = testStaticRequest(t, o, "/a.txt", "If-None-Match", etag)
+	expect(t, recorder.Code, http.StatusOK)
+	refute(t, recorder.Header().Get("ETag"), etag)
+	expect(t, recorder.Body.String(), "second")
+}
+
+func TestStaticCacheRules(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"app.3f9a1c.js", "app.js", "a.css", "img/a.png"} {
+		os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), os.ModePerm)
+		os.WriteFile(filepath.Join(dir, name), []byte(name), 0644)
+	}
+
+	o := New(Static(StaticOptions{
+		RootPath:  dir,
+		Immutable: true,
+		CacheRules: []CacheRule{
+			{Pattern: "*.css", CacheControl: "public, max-age=60"},
+			{Pattern: "/img/*", CacheControl: "no-cache", Expires: time.Hour},
+		},
+	}))
+
+	recorder := testStaticRequest(t, o, "/app.3f9a1c.js")
+	expect(t, recorder.Header().Get("Cache-Control"), "public, max-age=31536000, immutable")
+	recorder = testStaticRequest(t, o, "/app.js")
+	expect(t, recorder.Header().Get("Cache-Control"), "")
+	recorder = testStaticRequest(t, o, "/a.css")
+	expect(t, recorder.Header().Get("Cache-Control"), "public, max-age=60")
+	recorder = testStaticRequest(t, o, "/img/a.png")
+	expect(t, recorder.Header().Get("Cache-Control"), "no-cache")
+	expires, err := http.ParseTime(recorder.Header().Get("Expires"))
+	expect(t, err, nil)
+	expect(t, expires.After(time.Now().Add(59*time.Minute)), true)
+
+	expect(t, IsFingerprinted("js/app.3f9a1c.min.js"), true)
+	expect(t, IsFingerprinted("app.min.js"), false)
+	expect(t, IsFingerprinted("3f9a1c.js"), false)
+	expect(t, IsFingerprinted("app.12345678.js"), true)
+	expect(t, IsFingerprinted("app.3f9a1.js"), false)
+	expect(t, IsFingerprinted("app.3F9A1C.js"), false)
+	expect(t, IsFingerprinted("ui.facade.js"), true)
+}
+
+func TestStaticManifestImmutable(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"app.3f9a1c.js", "ui.facade.js"} {
+		os.WriteFile(filepath.Join(dir, name), []byte(name), 0644)
+	}
+
+	manifest := NewManifest(map[string]string{"app.js": "app.3f9a1c.js"})
+	o := New(Static(StaticOptions{
+		RootPath:  dir,
+		Immutable: true,
+		Manifest:  manifest,
+	}))
+
+	recorder := testStaticRequest(t, o, "/app.3f9a1c.js")
+	expect(t, recorder.Header().Get("Cache-Control"), immutableCacheControl)
+	recorder = testStaticRequest(t, o, "/ui.facade.js")
+	expect(t, recorder.Header().Get("Cache-Control"), "")
+
+	// the replaced names are not fingerprinted anymore
+	manifest.Set("app.js", "app.4e8b2d.js")
+	expect(t, manifest.IsFingerprinted("app.3f9a1c.js"), false)
+	expect(t, manifest.IsFingerprinted("/app.4e8b2d.js"), true)
+}
+
+func TestStaticFS(t *testing.T) {
+	o := New(Static(StaticOptions{FS: testPublicSub(t), Prefix: "/public"}))
+
+	recorder := testStaticRequest(t, o, "/public/test.html")
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, recorder.Body.String(), "hello tango")
+	expect(t, recorder.Header().Get("Last-Modified"), "")
+	// the embedded files have no modtime, so they have the content hash
+	etag := recorder.Header().Get("ETag")
+	expect(t, len(etag), 34)
+
+	recorder = testStaticRequest(t, o, "/public/test.html", "If-None-Match", etag)
+	expect(t, recorder.Code, http.StatusNotModified)
+
+	recorder = testStaticRequest(t, o, "/public/")
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, recorder.Body.String(), "this is index.html")
+
+	recorder = testStaticRequest(t, o, "/public/missing.html")
+	expect(t, recorder.Code, http.StatusNotFound)
+}
+
+func TestStaticFSModTime(t *testing.T) {
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	o := New(Static(StaticOptions{FS: testPublicSub(t), ModTime: modTime}))
+
+	recorder := testStaticRequest(t, o, "/js/my.js")
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, recorder.Body.String(), "var test")
+	expect(t, recorder.Header().Get("Last-Modified"), modTime.Format(http.TimeFormat))
+	expect(t, recorder.Header().Get("ETag"), "")
+
+	recorder = testStaticRequest(t, o, "/js/my.js", "If-Modified-Since", modTime.Format(http.TimeFormat))
+	expect(t, recorder.Code, http.StatusNotModified)
+}
+
+func TestStaticFallback(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("spa"), 0644)
+	os.WriteFile(filepath.Join(dir, "app.js"), []byte("js"), 0644)
+
+	o := New(Static(StaticOptions{
+		RootPath:         dir,
+		Prefix:           "/app",
+		Fallback:         "index.html",
+		FallbackExcludes: []string{"/app/api"},
+	}))
+
+	const accept = "text/html,application/xhtml+xml,*/*;q=0.8"
+	recorder := testStaticRequest(t, o, "/app/users/5", "Accept", accept)
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, recorder.Body.String(), "spa")
+	expect(t, recorder.Header().Get(HeaderVary), "Accept")
+
+	recorder = testStaticRequest(t, o, "/app/app.js", "Accept", accept)
+	expect(t, recorder.Body.String(), "js")
+
+	for _, url := range []string{"/app/missing.js", "/app/api/users"} {
+		recorder = testStaticRequest(t, o, url, "Accept", accept)
+		expect(t, recorder.Code, http.StatusNotFound)
+	}
+
+	recorder = testStaticRequest(t, o, "/app/users/5", "Accept", "application/json")
+	expect(t, recorder.Code, http.StatusNotFound)
+
+	// the routes are served by their actions
+	o = New(Static(StaticOptions{RootPath: dir, Fallback: "index.html"}), Return())
+	o.Get("/users", func() string {
+		return "users"
+	})
+	recorder = testStaticRequest(t, o, "/users", "Accept", accept)
+	expect(t, recorder.Body.String(), "users")
+	recorder = testStaticRequest(t, o, "/users/5", "Accept", accept)
+	expect(t, recorder.Body.String(), "spa")
+}
@@ -0,0 +1,110 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tango
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_MODIFY | syscall.IN_ATTRIB | syscall.IN_CLOSE_WRITE |
+	syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO |
+	syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+// inotifyWatcher watches the directories by inotify
+type inotifyWatcher struct {
+	root       string
+	fd         int
+	file       *os.File
+	invalidate func(name string)
+
+	lock sync.Mutex
+	dirs map[string]int32
+	wds  map[int32]string
+}
+
+func newFileWatcher(root string, invalidate func(name string)) (fileWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	w := &inotifyWatcher{
+		root:       root,
+		fd:         fd,
+		file:       os.NewFile(uintptr(fd), "inotify"),
+		invalidate: invalidate,
+		dirs:       make(map[string]int32),
+		wds:        make(map[int32]string),
+	}
+	go w.run()
+	return w, nil
+}
+
+func (w *inotifyWatcher) add(dir string) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if _, ok := w.dirs[dir]; ok {
+		return nil
+	}
+	wd, err := syscall.InotifyAddWatch(w.fd, filepath.Join(w.root, filepath.FromSlash(dir)), inotifyMask)
+	if err != nil {
+		return err
+	}
+	w.dirs[dir] = int32(wd)
+	w.wds[int32(wd)] = dir
+	return nil
+}
+
+func (w *inotifyWatcher) close() error {
+	return w.file.Close()
+}
+
+func (w *inotifyWatcher) run() {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			// the events could be lost, so nothing could be trusted
+			w.invalidate("")
+			return
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameBytes := buf[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+int(event.Len)]
+			offset += syscall.SizeofInotifyEvent + int(event.Len)
+			w.handle(event, string(bytes.TrimRight(nameBytes, "\x00")))
+		}
+	}
+}
+
+func (w *inotifyWatcher) handle(event *syscall.InotifyEvent, name string) {
+	if event.Mask&syscall.IN_Q_OVERFLOW != 0 {
+		w.invalidate("")
+		return
+	}
+
+	w.lock.Lock()
+	dir, ok := w.wds[event.Wd]
+	if ok && event.Mask&(syscall.IN_IGNORED|syscall.IN_DELETE_SELF|syscall.IN_MOVE_SELF) != 0 {
+		delete(w.wds, event.Wd)
+		delete(w.dirs, dir)
+	}
+	w.lock.Unlock()
+	if !ok {
+		return
+	}
+
+	if name == "" {
+		// the directory itself is removed or moved
+		w.invalidate("")
+		return
+	}
+	w.invalidate(path.Join(dir, name))
+}
@@ -0,0 +1,14 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+
+package tango
+
+import "errors"
+
+// newFileWatcher isn't supported, so the modtime of the cached files is checked
+func newFileWatcher(root string, invalidate func(name string)) (fileWatcher, error) {
+	return nil, errors.New("tango: watching files is not supported")
+}
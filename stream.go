@@ -0,0 +1,253 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tango
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// streamFlushInterval is the maximum duration the streamed data are buffered
+const streamFlushInterval = 100 * time.Millisecond
+
+// NDJSON describes return newline delimited JSON type, the channels and the
+// iterators results are written one JSON value per line
+type NDJSON struct{}
+
+// ResponseType implementes ResponseTyper
+func (NDJSON) ResponseType() int {
+	return ndjsonResponse
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// streamFunc returns a function calling yield for every element of a
+// channel or an iterator result until yield returns false. The supported
+// results are <-chan T, func() (T, bool), iter.Seq[T] and iter.Seq2[T, error].
+func streamFunc(ctx *Context, result interface{}) (func(yield func(interface{}) bool), bool) {
+	v := reflect.ValueOf(result)
+	t := v.Type()
+	switch t.Kind() {
+	case reflect.Chan:
+		if t.ChanDir()&reflect.RecvDir == 0 {
+			return nil, false
+		}
+		return func(yield func(interface{}) bool) {
+			cases := []reflect.SelectCase{
+				{Dir: reflect.SelectRecv, Chan: v},
+				{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Req().Context().Done())},
+			}
+			for {
+				elem, ok := v.TryRecv()
+				if !ok {
+					if !elem.IsValid() {
+						// nothing is ready, send the buffered data before waiting
+						ctx.Flush()
+						var chosen int
+						chosen, elem, ok = reflect.Select(cases)
+						if chosen == 1 {
+							return
+						}
+					}
+					if !ok {
+						return
+					}
+				}
+				if !yield(elem.Interface()) {
+					return
+				}
+			}
+		}, true
+	case reflect.Func:
+		if v.IsNil() {
+			return nil, false
+		}
+		// func() (T, bool)
+		if t.NumIn() == 0 && t.NumOut() == 2 && t.Out(1).Kind() == reflect.Bool {
+			return func(yield func(interface{}) bool) {
+				for {
+					out := v.Call(nil)
+					if !out[1].Bool() || !yield(out[0].Interface()) {
+						return
+					}
+				}
+			}, true
+		}
+		if t.NumIn() != 1 || t.NumOut() != 0 {
+			return nil, false
+		}
+		yt := t.In(0)
+		if yt.Kind() != reflect.Func || yt.NumOut() != 1 || yt.Out(0).Kind() != reflect.Bool {
+			return nil, false
+		}
+		// iter.Seq[T]
+		if yt.NumIn() == 1 {
+			return func(yield func(interface{}) bool) {
+				v.Call([]reflect.Value{reflect.MakeFunc(yt, func(args []reflect.Value) []reflect.Value {
+					return []reflect.Value{reflect.ValueOf(yield(args[0].Interface()))}
+				})})
+			}, true
+		}
+		// iter.Seq2[T, error]
+		if yt.NumIn() == 2 && yt.In(1) == errorType {
+			return func(yield func(interface{}) bool) {
+				v.Call([]reflect.Value{reflect.MakeFunc(yt, func(args []reflect.Value) []reflect.Value {
+					if err := args[1].Interface(); err != nil {
+						return []reflect.Value{reflect.ValueOf(yield(err))}
+					}
+					return []reflect.Value{reflect.ValueOf(yield(args[0].Interface()))}
+				})})
+			}, true
+		}
+	}
+	return nil, false
+}
+
+// wantsNDJSON returns true if the client accepts NDJSON
+func wantsNDJSON(req *http.Request) bool {
+	return strings.Contains(req.Header.Get("Accept"), "application/x-ndjson")
+}
+
+// streamResult writes a streaming result and returns true, it returns
+// false if the result isn't an io.Reader, a channel or an iterator
+func streamResult(ctx *Context, rt, statusCode int, result interface{}) bool {
+	if isNil(result) {
+		return false
+	}
+	if _, ok := result.(error); ok {
+		return false
+	}
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+
+	if r, ok := result.(io.Reader); ok {
+		if c, ok := r.(io.Closer); ok {
+			defer c.Close()
+		}
+		ctx.copyFlush(rt, statusCode, r)
+		return true
+	}
+
+	each, ok := streamFunc(ctx, result)
+	if !ok {
+		return false
+	}
+
+	if rt == jsonResponse && wantsNDJSON(ctx.Req()) {
+		rt = ndjsonResponse
+	}
+	var encode func(interface{}) error
+	var end string
+	switch rt {
+	case jsonResponse:
+		ctx.setDefaultContentType("application/json; charset=UTF-8")
+		ctx.WriteHeader(statusCode)
+		ctx.WriteString("[")
+		end = "]\n"
+		var n int
+		encode = func(elem interface{}) error {
+			bs, err := json.Marshal(elem)
+			if err != nil {
+				return err
+			}
+			if n > 0 {
+				ctx.WriteString(",")
+			}
+			n++
+			_, err = ctx.Write(bs)
+			return err
+		}
+	case xmlResponse:
+		ctx.setDefaultContentType("application/xml; charset=UTF-8")
+		ctx.WriteHeader(statusCode)
+		ctx.WriteString("<items>")
+		end = "</items>\n"
+		encoder := xml.NewEncoder(ctx)
+		encode = func(elem interface{}) error {
+			return encoder.Encode(elem)
+		}
+	default:
+		ctx.setDefaultContentType("application/x-ndjson")
+		ctx.WriteHeader(statusCode)
+		encoder := json.NewEncoder(ctx)
+		encode = func(elem interface{}) error {
+			return encoder.Encode(elem)
+		}
+	}
+
+	lastFlush := time.Now()
+	var failed bool
+	each(func(elem interface{}) bool {
+		err, _ := elem.(error)
+		if err == nil {
+			err = encode(elem)
+		}
+		if err != nil {
+			ctx.Error("stream stopped:", err)
+			failed = true
+			return false
+		}
+		if time.Since(lastFlush) >= streamFlushInterval {
+			ctx.Flush()
+			lastFlush = time.Now()
+		}
+		return ctx.Req().Context().Err() == nil
+	})
+	// a truncated array is left unterminated, so that it's not valid
+	if !failed {
+		ctx.WriteString(end)
+	}
+	ctx.Flush()
+	return true
+}
+
+func (ctx *Context) setDefaultContentType(contentType string) {
+	if len(ctx.Header().Get(HeaderContentType)) == 0 {
+		ctx.Header().Set(HeaderContentType, contentType)
+	}
+}
+
+// copyFlush copies r to the response and flushes every chunk, the content
+// type is detected from the first chunk if it's not set by the action
+func (ctx *Context) copyFlush(rt, statusCode int, r io.Reader) error {
+	buf := make([]byte, 32*1024)
+	n, err := io.ReadAtLeast(r, buf, 1)
+	switch rt {
+	case jsonResponse:
+		ctx.setDefaultContentType("application/json; charset=UTF-8")
+	case xmlResponse:
+		ctx.setDefaultContentType("application/xml; charset=UTF-8")
+	case ndjsonResponse:
+		ctx.setDefaultContentType("application/x-ndjson")
+	default:
+		if n > 0 {
+			ctx.setDefaultContentType(http.DetectContentType(buf[:n]))
+		}
+	}
+	ctx.WriteHeader(statusCode)
+
+	for {
+		if n > 0 {
+			if _, werr := ctx.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			ctx.Flush()
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			ctx.Error("stream stopped:", err)
+			return err
+		}
+		n, err = r.Read(buf)
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tango
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type streamRow struct {
+	ID int `json:"id" xml:"id"`
+}
+
+func rowsChan(done <-chan struct{}, n int) <-chan streamRow {
+	c := make(chan streamRow)
+	go func() {
+		defer close(c)
+		for i := 1; i <= n; i++ {
+			select {
+			case c <- streamRow{i}:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return c
+}
+
+type streamJSONAction struct {
+	JSON
+	Ctx
+}
+
+func (a *streamJSONAction) Get() interface{} {
+	return rowsChan(a.Done(), 3)
+}
+
+type streamXMLAction struct {
+	XML
+	Ctx
+}
+
+func (a *streamXMLAction) Get() interface{} {
+	return rowsChan(a.Done(), 2)
+}
+
+type streamErrorAction struct {
+	JSON
+}
+
+func (streamErrorAction) Get() interface{} {
+	c := make(chan interface{}, 2)
+	c <- streamRow{1}
+	c <- errors.New("failed")
+	close(c)
+	return c
+}
+
+type streamNDJSONAction struct {
+	NDJSON
+}
+
+func (streamNDJSONAction) Get() (int, interface{}) {
+	var i int
+	return http.StatusCreated, func() (streamRow, bool) {
+		i++
+		return streamRow{i}, i <= 2
+	}
+}
+
+type closeReader struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeReader) Close() error {
+	c.closed = true
+	return nil
+}
+
+func testStream(t *testing.T, o *Tango, url, accept string, code int, contentType, expected string) {
+	req, err := http.NewRequest("GET", "http://localhost:8000"+url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	recorder := httptest.NewRecorder()
+	o.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, code)
+	expect(t, recorder.Header().Get(HeaderContentType), contentType)
+	expect(t, recorder.Body.String(), expected)
+}
+
+func TestReturnStream(t *testing.T) {
+	reader := &closeReader{Reader: strings.NewReader("raw content")}
+	seq := func(yield func(int) bool) {
+		for i := 1; i <= 3; i++ {
+			if !yield(i) {
+				return
+			}
+		}
+	}
+	seq2 := func(yield func(string, error) bool) {
+		if !yield("a", nil) {
+			t.Error("yield should return true")
+		}
+		if yield("", errors.New("failed")) {
+			t.Error("yield should return false")
+		}
+	}
+
+	o := Classic()
+	o.Get("/json", new(streamJSONAction))
+	o.Get("/xml", new(streamXMLAction))
+	o.Get("/error", new(streamErrorAction))
+	o.Get("/ndjson", new(streamNDJSONAction))
+	o.Get("/reader", func() io.Reader {
+		return reader
+	})
+	o.Get("/seq", func() interface{} {
+		return seq
+	})
+	o.Get("/seq2", func() interface{} {
+		return seq2
+	})
+
+	testStream(t, o, "/json", "", http.StatusOK, "application/json; charset=UTF-8",
+		`[{"id":1},{"id":2},{"id":3}]`+"\n")
+	testStream(t, o, "/json", "application/x-ndjson", http.StatusOK, "application/x-ndjson",
+		"{\"id\":1}\n{\"id\":2}\n{\"id\":3}\n")
+	testStream(t, o, "/xml", "", http.StatusOK, "application/xml; charset=UTF-8",
+		"<items><streamRow><id>1</id></streamRow><streamRow><id>2</id></streamRow></items>\n")
+	// a failed stream is not a valid JSON array
+	testStream(t, o, "/error", "", http.StatusOK, "application/json; charset=UTF-8", `[{"id":1}`)
+	testStream(t, o, "/ndjson", "", http.StatusCreated, "application/x-ndjson",
+		"{\"id\":1}\n{\"id\":2}\n")
+	testStream(t, o, "/reader", "", http.StatusOK, "text/plain; charset=utf-8", "raw content")
+	expect(t, reader.closed, true)
+	testStream(t, o, "/seq", "", http.StatusOK, "application/x-ndjson", "1\n2\n3\n")
+	testStream(t, o, "/seq2", "", http.StatusOK, "application/x-ndjson", "\"a\"\n")
+}
+
+func TestReturnStreamFlush(t *testing.T) {
+	c := make(chan string)
+	o := Classic()
+	o.Get("/", func() <-chan string {
+		return c
+	})
+	srv := httptest.NewServer(o)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	r := bufio.NewReader(resp.Body)
+
+	// every row is received before the next one is sent
+	for _, s := range []string{"a", "b"} {
+		c <- s
+		line, err := r.ReadString('\n')
+		expect(t, err, nil)
+		expect(t, line, `"`+s+`"`+"\n")
+	}
+	close(c)
+	_, err = r.ReadString('\n')
+	expect(t, err, io.EOF)
+}
+
+func TestReturnStreamDisconnect(t *testing.T) {
+	stopped := make(chan bool)
+	o := Classic()
+	o.Get("/", func(ctx *Context) <-chan int {
+		done := ctx.Done()
+		c := make(chan int)
+		go func() {
+			defer close(stopped)
+			for i := 0; ; i++ {
+				select {
+				case c <- i:
+				case <-done:
+					return
+				}
+			}
+		}()
+		return c
+	})
+	srv := httptest.NewServer(o)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = bufio.NewReader(resp.Body).ReadString('\n')
+	expect(t, err, nil)
+	resp.Body.Close()
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the sending goroutine should stop when the client disconnects")
+	}
+}
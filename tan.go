@@ -5,6 +5,7 @@
 package tango
 
 import (
+	"net"
 	"net/http"
 	"os"
 	"strconv"
@@ -26,6 +27,15 @@ type Tango struct {
 	ErrHandler Handler
 	ctxPool    sync.Pool
 	respPool   sync.Pool
+
+	// Renderer renders the templates returned by the actions
+	Renderer *Renderer
+
+	trustedProxies []*net.IPNet
+	proxyHeader    string
+
+	// fieldLogger is the parent of the request loggers
+	fieldLogger FieldLogger
 }
 
 var (
@@ -213,6 +223,8 @@ func (t *Tango) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 	ctx.invoke()
 
+	ctx.closeStreams()
+
 	// if there is no logging or error handle, so the last written check.
 	if !ctx.Written() {
 		p := req.URL.Path
@@ -224,8 +236,7 @@ func (t *Tango) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 			if ctx.Result == nil {
 				ctx.WriteString("")
 				t.logger.Info(req.Method, ctx.Status(), p)
-				t.ctxPool.Put(ctx)
-				t.respPool.Put(resp)
+				t.release(ctx, resp)
 				return
 			}
 			panic("result should be handler before")
@@ -240,8 +251,7 @@ func (t *Tango) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		t.logger.Error(req.Method, ctx.Status(), p)
 	}
 
-	t.ctxPool.Put(ctx)
-	t.respPool.Put(resp)
+	t.release(ctx, resp)
 }
 
 // NewWithLog creates tango with the special logger and handlers
@@ -252,6 +262,7 @@ func NewWithLog(logger Logger, handlers ...Handler) *Tango {
 		handlers:   make([]Handler, 0),
 		ErrHandler: Errors(),
 	}
+	tan.fieldLogger = ToFieldLogger(logger)
 
 	tan.ctxPool.New = func() interface{} {
 		return &Context{
@@ -0,0 +1,11 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build race
+// +build race
+
+package tangotest
+
+// RaceEnabled reports if the race detector is enabled
+const RaceEnabled = true
@@ -0,0 +1,42 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package tangotest provides helpers for testing tango applications.
+package tangotest
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/lunny/tango"
+)
+
+// Main runs the tests with tango.PoisonReleased enabled and exits, it
+// should be called from TestMain:
+//
+//	func TestMain(m *testing.M) {
+//	    tangotest.Main(m)
+//	}
+//
+// The tests must be run under the race detector, i.e. go test -race,
+// so that released Contexts shared with other goroutines are reported.
+func Main(m *testing.M) {
+	os.Exit(Run(m))
+}
+
+// Run is like Main but returns the exit code instead of exiting
+func Run(m *testing.M) int {
+	if !RaceEnabled {
+		fmt.Fprintln(os.Stderr, "tangotest: the race detector is disabled, run the tests with go test -race")
+		return 1
+	}
+
+	old := tango.PoisonReleased
+	tango.PoisonReleased = true
+	defer func() {
+		tango.PoisonReleased = old
+	}()
+	return m.Run()
+}
@@ -0,0 +1,50 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tangotest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/lunny/tango"
+)
+
+func TestMain(m *testing.M) {
+	if !RaceEnabled {
+		// Run refuses to run without the race detector
+		os.Exit(m.Run())
+	}
+	Main(m)
+}
+
+func TestPoisoned(t *testing.T) {
+	if !RaceEnabled {
+		t.Skip("the race detector is disabled")
+	}
+	if !tango.PoisonReleased {
+		t.Fatal("PoisonReleased should be enabled")
+	}
+
+	var kept *tango.Context
+	o := tango.New()
+	o.Get("/", func(ctx *tango.Context) {
+		kept = ctx
+	})
+
+	req, err := http.NewRequest("GET", "http://localhost:8000/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.ServeHTTP(httptest.NewRecorder(), req)
+
+	defer func() {
+		if recover() == nil {
+			t.Error("using a released context should panic")
+		}
+	}()
+	kept.Req()
+}
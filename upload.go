@@ -0,0 +1,487 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tango
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// MaxMultipartMemory is the maximum memory used to parse multipart forms
+// by Forms and SaveToFile, the larger files are stored on disk
+var MaxMultipartMemory int64 = 32 << 20
+
+// sniffLen is the number of bytes needed by http.DetectContentType
+const sniffLen = 512
+
+// UploadError describes an upload failure, it implements AbortError so
+// the action could return it directly
+type UploadError struct {
+	code     int
+	Field    string
+	Filename string
+	Message  string
+}
+
+// Code returns the HTTP status code of the error
+func (e *UploadError) Code() int {
+	return e.code
+}
+
+func (e *UploadError) Error() string {
+	if e.Filename != "" {
+		return fmt.Sprintf("%s: %s", e.Filename, e.Message)
+	}
+	return e.Message
+}
+
+// UploadStorage stores the uploaded files
+type UploadStorage interface {
+	// Save stores the content of file and returns where it's stored. The
+	// content returns an error if the upload limits are exceeded, the
+	// storage should not keep the file then.
+	Save(file *UploadedFile, content io.Reader) (location string, err error)
+}
+
+// UploadOpener is implemented by the storages which could read the files back
+type UploadOpener interface {
+	Open(location string) (io.ReadCloser, error)
+}
+
+// UploadRemover is implemented by the storages which could remove the files,
+// the files already saved are removed when an upload fails
+type UploadRemover interface {
+	Remove(location string) error
+}
+
+// UploadStorageFunc is a function implementing UploadStorage
+type UploadStorageFunc func(file *UploadedFile, content io.Reader) (string, error)
+
+// Save implements UploadStorage
+func (f UploadStorageFunc) Save(file *UploadedFile, content io.Reader) (string, error) {
+	return f(file, content)
+}
+
+// DirStorage stores the uploaded files in a local directory, a number is
+// appended to the file name if the file already exists.
+type DirStorage struct {
+	Dir string
+}
+
+// Save implements UploadStorage
+func (s DirStorage) Save(file *UploadedFile, content io.Reader) (string, error) {
+	if err := os.MkdirAll(s.Dir, os.ModePerm); err != nil {
+		return "", err
+	}
+
+	ext := filepath.Ext(file.Filename)
+	base := strings.TrimSuffix(file.Filename, ext)
+	var f *os.File
+	var p string
+	for i := 0; ; i++ {
+		name := file.Filename
+		if i > 0 {
+			name = base + "-" + strconv.Itoa(i) + ext
+		}
+		p = filepath.Join(s.Dir, name)
+
+		var err error
+		f, err = os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) || i >= 1000 {
+			return "", err
+		}
+	}
+
+	_, err := io.Copy(f, content)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(p)
+		return "", err
+	}
+	return p, nil
+}
+
+// Open implements UploadOpener
+func (s DirStorage) Open(location string) (io.ReadCloser, error) {
+	return os.Open(location)
+}
+
+// Remove implements UploadRemover
+func (s DirStorage) Remove(location string) error {
+	return os.Remove(location)
+}
+
+// MemoryStorage keeps the uploaded files in memory
+type MemoryStorage struct {
+	lock  sync.RWMutex
+	files map[string][]byte
+}
+
+// NewMemoryStorage creates a MemoryStorage
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		files: make(map[string][]byte),
+	}
+}
+
+// Save implements UploadStorage, the location is the field and the file name
+func (s *MemoryStorage) Save(file *UploadedFile, content io.Reader) (string, error) {
+	data, err := ioutil.ReadAll(content)
+	if err != nil {
+		return "", err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	location := file.Field + "/" + file.Filename
+	for i := 1; ; i++ {
+		if _, ok := s.files[location]; !ok {
+			break
+		}
+		location = file.Field + "/" + strconv.Itoa(i) + "-" + file.Filename
+	}
+	s.files[location] = data
+	return location, nil
+}
+
+// Open implements UploadOpener
+func (s *MemoryStorage) Open(location string) (io.ReadCloser, error) {
+	data, ok := s.Get(location)
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Remove implements UploadRemover
+func (s *MemoryStorage) Remove(location string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.files[location]; !ok {
+		return os.ErrNotExist
+	}
+	delete(s.files, location)
+	return nil
+}
+
+// Get returns the content of a stored file
+func (s *MemoryStorage) Get(location string) ([]byte, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	data, ok := s.files[location]
+	return data, ok
+}
+
+// UploadOptions defines the options of Context.Upload
+type UploadOptions struct {
+	// MaxFileSize is the maximum size of a file, default is 32MB
+	MaxFileSize int64
+	// MaxTotalSize is the maximum size of all the files and values, default is 64MB
+	MaxTotalSize int64
+	// MaxFiles is the maximum number of files, default is unlimited
+	MaxFiles int
+	// AllowedTypes are the allowed content types sniffed from the file
+	// content, e.g. "image/png" or "image/*". Default allows all types.
+	AllowedTypes []string
+	// Storage stores the files, default is a new MemoryStorage
+	Storage UploadStorage
+}
+
+// UploadedFile describes an uploaded file
+type UploadedFile struct {
+	// Field is the form field name
+	Field string
+	// Filename is the sanitized file name
+	Filename string
+	// OriginalFilename is the file name sent by the client
+	OriginalFilename string
+	// ContentType is sniffed from the file content
+	ContentType string
+	Size        int64
+	Header      textproto.MIMEHeader
+	// Location is where the storage saved the file
+	Location string
+
+	storage UploadStorage
+}
+
+// Open opens the stored file if the storage implements UploadOpener
+func (f *UploadedFile) Open() (io.ReadCloser, error) {
+	if opener, ok := f.storage.(UploadOpener); ok {
+		return opener.Open(f.Location)
+	}
+	return nil, errors.New("tango: the upload storage could not open files")
+}
+
+// Upload is the result of Context.Upload
+type Upload struct {
+	Files  []*UploadedFile
+	Values url.Values
+}
+
+// File returns the first file of field
+func (u *Upload) File(field string) *UploadedFile {
+	for _, f := range u.Files {
+		if f.Field == field {
+			return f
+		}
+	}
+	return nil
+}
+
+// FilesOf returns all the files of field
+func (u *Upload) FilesOf(field string) []*UploadedFile {
+	var files []*UploadedFile
+	for _, f := range u.Files {
+		if f.Field == field {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// removeFiles removes the saved files if the storage implements UploadRemover
+func (u *Upload) removeFiles(storage UploadStorage) {
+	remover, ok := storage.(UploadRemover)
+	if !ok {
+		return
+	}
+	for _, f := range u.Files {
+		remover.Remove(f.Location)
+	}
+	u.Files = nil
+}
+
+// SanitizeFilename returns a file name safe to be stored, the directories,
+// the control and reserved characters and the leading dots are removed.
+func SanitizeFilename(name string) string {
+	// the browsers on windows may send the full path
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsControl(r), r == unicode.ReplacementChar:
+			return -1
+		case strings.ContainsRune(`<>:"|?*`, r):
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.TrimLeft(strings.TrimSpace(name), ".")
+	name = strings.TrimRight(name, ". ")
+	for len(name) > 255 {
+		ext := filepath.Ext(name)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		name = strings.ToValidUTF8(name[:255-len(ext)], "") + ext
+	}
+	if name == "" {
+		return "file"
+	}
+	return name
+}
+
+func isAllowedType(contentType string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, a := range allowed {
+		a = strings.ToLower(a)
+		if a == mediaType || a == "*/*" ||
+			(strings.HasSuffix(a, "/*") && strings.HasPrefix(mediaType, a[:len(a)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+// limitedUploadReader counts the read bytes and fails when the limits are exceeded
+type limitedUploadReader struct {
+	r         io.Reader
+	n         int64
+	fileLimit int64
+	totalLeft int64
+	err       error
+}
+
+func (l *limitedUploadReader) Read(p []byte) (int, error) {
+	if l.err != nil {
+		return 0, l.err
+	}
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	if l.n > l.totalLeft {
+		l.err = &UploadError{code: http.StatusRequestEntityTooLarge, Message: "upload is too large"}
+	} else if l.n > l.fileLimit {
+		l.err = &UploadError{code: http.StatusRequestEntityTooLarge, Message: "file is too large"}
+	}
+	if l.err != nil {
+		return 0, l.err
+	}
+	return n, err
+}
+
+// badUpload returns the error of reading the request body
+func badUpload(field, filename string, err error) error {
+	if berr, ok := bodyError(err).(*BodyTooLargeError); ok {
+		return berr
+	}
+	return &UploadError{code: http.StatusBadRequest, Field: field, Filename: filename, Message: err.Error()}
+}
+
+// Upload streams the multipart request body, the files are saved by the
+// storage and the other values are returned and could be read by Forms
+// later. The files and the total size are limited. If the upload fails, the
+// files already saved are removed when the storage implements UploadRemover.
+func (ctx *Context) Upload(opts ...UploadOptions) (upload *Upload, err error) {
+	var opt UploadOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.MaxFileSize <= 0 {
+		opt.MaxFileSize = 32 << 20
+	}
+	if opt.MaxTotalSize <= 0 {
+		opt.MaxTotalSize = 64 << 20
+	}
+	if opt.Storage == nil {
+		opt.Storage = NewMemoryStorage()
+	}
+
+	req := ctx.Req()
+	mr, err := req.MultipartReader()
+	if err != nil {
+		return nil, &UploadError{code: http.StatusBadRequest, Message: err.Error()}
+	}
+
+	upload = &Upload{Values: make(url.Values)}
+	defer func() {
+		if err != nil {
+			upload.removeFiles(opt.Storage)
+		}
+	}()
+
+	var total int64
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return upload, badUpload("", "", err)
+		}
+
+		field := part.FormName()
+		if field == "" {
+			part.Close()
+			continue
+		}
+
+		if part.FileName() == "" {
+			value, err := ioutil.ReadAll(io.LimitReader(part, opt.MaxTotalSize-total+1))
+			part.Close()
+			if err != nil {
+				return upload, badUpload(field, "", err)
+			}
+			total += int64(len(value))
+			if total > opt.MaxTotalSize {
+				return upload, &UploadError{code: http.StatusRequestEntityTooLarge, Field: field, Message: "upload is too large"}
+			}
+			upload.Values.Add(field, string(value))
+			continue
+		}
+
+		if opt.MaxFiles > 0 && len(upload.Files) >= opt.MaxFiles {
+			part.Close()
+			return upload, &UploadError{code: http.StatusRequestEntityTooLarge, Field: field, Message: "too many files"}
+		}
+
+		file, err := ctx.saveUploadPart(part, field, &opt, opt.MaxTotalSize-total)
+		part.Close()
+		if file != nil {
+			total += file.Size
+		}
+		if err != nil {
+			return upload, err
+		}
+		upload.Files = append(upload.Files, file)
+	}
+
+	// so that the values could be read by Forms
+	req.PostForm = upload.Values
+	req.Form = nil
+	req.MultipartForm = &multipart.Form{Value: upload.Values}
+	return upload, nil
+}
+
+// originalFilename returns the file name sent by the client, part.FileName
+// strips the directories
+func originalFilename(part *multipart.Part) string {
+	_, params, err := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+	if err != nil || params["filename"] == "" {
+		return part.FileName()
+	}
+	return params["filename"]
+}
+
+func (ctx *Context) saveUploadPart(part *multipart.Part, field string, opt *UploadOptions, totalLeft int64) (*UploadedFile, error) {
+	file := &UploadedFile{
+		Field:            field,
+		Filename:         SanitizeFilename(part.FileName()),
+		OriginalFilename: originalFilename(part),
+		Header:           part.Header,
+		storage:          opt.Storage,
+	}
+
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(part, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, badUpload(field, file.Filename, err)
+	}
+	file.ContentType = http.DetectContentType(head[:n])
+	if !isAllowedType(file.ContentType, opt.AllowedTypes) {
+		return nil, &UploadError{code: http.StatusUnsupportedMediaType, Field: field, Filename: file.Filename,
+			Message: "file type " + file.ContentType + " is not allowed"}
+	}
+
+	reader := &limitedUploadReader{
+		r:         io.MultiReader(bytes.NewReader(head[:n]), part),
+		fileLimit: opt.MaxFileSize,
+		totalLeft: totalLeft,
+	}
+	file.Location, err = opt.Storage.Save(file, reader)
+	file.Size = reader.n
+	if reader.err != nil {
+		uerr := reader.err.(*UploadError)
+		uerr.Field, uerr.Filename = field, file.Filename
+		return file, uerr
+	}
+	return file, bodyError(err)
+}
@@ -0,0 +1,211 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tango
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var pngHeader = []byte("\x89PNG\x0D\x0A\x1A\x0A")
+
+type uploadPart struct {
+	field, filename string
+	content         []byte
+}
+
+func newUploadRequest(t *testing.T, parts ...uploadPart) *http.Request {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for _, p := range parts {
+		if p.filename == "" {
+			w.WriteField(p.field, string(p.content))
+			continue
+		}
+		fw, err := w.CreateFormFile(p.field, p.filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(p.content)
+	}
+	w.Close()
+
+	req, err := http.NewRequest("POST", "http://localhost:8000/upload?q=1", &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return req
+}
+
+func TestUpload(t *testing.T) {
+	storage := NewMemoryStorage()
+	var upload *Upload
+	var name string
+
+	o := Classic()
+	o.Post("/upload", func(ctx *Context) error {
+		var err error
+		upload, err = ctx.Upload(UploadOptions{Storage: storage})
+		name = ctx.Forms().MustString("name")
+		expect(t, ctx.Forms().MustString("q"), "1")
+		return err
+	})
+
+	png := append(append([]byte{}, pngHeader...), bytes.Repeat([]byte{1}, 1000)...)
+	req := newUploadRequest(t,
+		uploadPart{"name", "", []byte("lunny")},
+		uploadPart{"photos", "../../etc/a.png", png},
+		uploadPart{"photos", `C:\Users\lunny\.b<1>.txt`, []byte("hello")},
+		uploadPart{"doc", "doc.txt", []byte("doc")},
+	)
+	recorder := httptest.NewRecorder()
+	o.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, name, "lunny")
+	expect(t, upload.Values.Get("name"), "lunny")
+	expect(t, len(upload.Files), 3)
+
+	photos := upload.FilesOf("photos")
+	expect(t, len(photos), 2)
+	expect(t, photos[0].Filename, "a.png")
+	expect(t, photos[0].OriginalFilename, "../../etc/a.png")
+	expect(t, photos[0].ContentType, "image/png")
+	expect(t, photos[0].Size, int64(len(png)))
+	expect(t, photos[1].Filename, "b_1_.txt")
+	expect(t, photos[1].ContentType, "text/plain; charset=utf-8")
+
+	data, ok := storage.Get(photos[0].Location)
+	expect(t, ok, true)
+	expect(t, bytes.Equal(data, png), true)
+
+	f, err := upload.File("doc").Open()
+	expect(t, err, nil)
+	content, _ := ioutil.ReadAll(f)
+	expect(t, string(content), "doc")
+	expect(t, upload.File("none") == nil, true)
+}
+
+func testUploadError(t *testing.T, opt UploadOptions, code int, parts ...uploadPart) {
+	var uploadErr error
+	o := Classic()
+	o.Post("/upload", func(ctx *Context) error {
+		_, uploadErr = ctx.Upload(opt)
+		return uploadErr
+	})
+
+	recorder := httptest.NewRecorder()
+	o.ServeHTTP(recorder, newUploadRequest(t, parts...))
+	expect(t, recorder.Code, code)
+	refute(t, uploadErr, nil)
+}
+
+func TestUploadLimits(t *testing.T) {
+	png := append(append([]byte{}, pngHeader...), bytes.Repeat([]byte{1}, 1000)...)
+
+	testUploadError(t, UploadOptions{MaxFileSize: 100}, http.StatusRequestEntityTooLarge,
+		uploadPart{"file", "a.png", png})
+	testUploadError(t, UploadOptions{MaxTotalSize: 1500}, http.StatusRequestEntityTooLarge,
+		uploadPart{"file", "a.png", png}, uploadPart{"file", "b.png", png})
+	testUploadError(t, UploadOptions{MaxTotalSize: 10}, http.StatusRequestEntityTooLarge,
+		uploadPart{"name", "", []byte("a long long value")})
+	testUploadError(t, UploadOptions{MaxFiles: 1}, http.StatusRequestEntityTooLarge,
+		uploadPart{"file", "a.png", png}, uploadPart{"file", "b.png", png})
+	testUploadError(t, UploadOptions{AllowedTypes: []string{"image/*"}}, http.StatusUnsupportedMediaType,
+		uploadPart{"file", "a.png", []byte("<html><body>fake</body></html>")})
+}
+
+func TestUploadNotMultipart(t *testing.T) {
+	var uploadErr error
+	o := Classic()
+	o.Post("/", func(ctx *Context) error {
+		_, uploadErr = ctx.Upload()
+		return uploadErr
+	})
+
+	req, err := http.NewRequest("POST", "http://localhost:8000/", strings.NewReader("a=1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	o.ServeHTTP(recorder, req)
+	expect(t, recorder.Code, http.StatusBadRequest)
+}
+
+func TestUploadDirStorage(t *testing.T) {
+	dir := t.TempDir()
+	var upload *Upload
+	o := Classic()
+	o.Post("/upload", func(ctx *Context) error {
+		var err error
+		upload, err = ctx.Upload(UploadOptions{
+			Storage:      DirStorage{dir},
+			AllowedTypes: []string{"text/plain"},
+			MaxFileSize:  10,
+		})
+		return err
+	})
+
+	recorder := httptest.NewRecorder()
+	o.ServeHTTP(recorder, newUploadRequest(t,
+		uploadPart{"file", "a.txt", []byte("first")},
+		uploadPart{"file", "a.txt", []byte("second")},
+	))
+	expect(t, recorder.Code, http.StatusOK)
+	expect(t, upload.Files[0].Location, filepath.Join(dir, "a.txt"))
+	expect(t, upload.Files[1].Location, filepath.Join(dir, "a-1.txt"))
+	content, _ := os.ReadFile(upload.Files[1].Location)
+	expect(t, string(content), "second")
+
+	// the partial file is removed when the limit is exceeded
+	recorder = httptest.NewRecorder()
+	o.ServeHTTP(recorder, newUploadRequest(t,
+		uploadPart{"file", "big.txt", []byte("more than ten bytes")},
+	))
+	expect(t, recorder.Code, http.StatusRequestEntityTooLarge)
+	_, err := os.Stat(filepath.Join(dir, "big.txt"))
+	expect(t, os.IsNotExist(err), true)
+
+	// the files saved before a failing part are removed
+	recorder = httptest.NewRecorder()
+	o.ServeHTTP(recorder, newUploadRequest(t,
+		uploadPart{"file", "saved.txt", []byte("saved")},
+		uploadPart{"file", "big.txt", []byte("more than ten bytes")},
+	))
+	expect(t, recorder.Code, http.StatusRequestEntityTooLarge)
+	expect(t, len(upload.Files), 0)
+	_, err = os.Stat(filepath.Join(dir, "saved.txt"))
+	expect(t, os.IsNotExist(err), true)
+}
+
+func TestUploadRemoveFiles(t *testing.T) {
+	storage := NewMemoryStorage()
+	png := append(append([]byte{}, pngHeader...), bytes.Repeat([]byte{1}, 1000)...)
+	testUploadError(t, UploadOptions{Storage: storage, AllowedTypes: []string{"image/*"}},
+		http.StatusUnsupportedMediaType,
+		uploadPart{"file", "a.png", png}, uploadPart{"file", "b.png", []byte("fake")})
+
+	_, ok := storage.Get("file/a.png")
+	expect(t, ok, false)
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	expect(t, SanitizeFilename("../../etc/passwd"), "passwd")
+	expect(t, SanitizeFilename(`..\..\boot.ini`), "boot.ini")
+	expect(t, SanitizeFilename(".env"), "env")
+	expect(t, SanitizeFilename("a\x00b\nc.txt"), "abc.txt")
+	expect(t, SanitizeFilename("文件 1.txt"), "文件 1.txt")
+	expect(t, SanitizeFilename("..."), "file")
+	expect(t, len(SanitizeFilename(strings.Repeat("a", 300)+".txt")), 255)
+	expect(t, strings.HasSuffix(SanitizeFilename(strings.Repeat("a", 300)+".txt"), ".txt"), true)
+}
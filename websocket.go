@@ -0,0 +1,533 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tango
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// WebSocket message types, the values are the opcodes defined in RFC 6455
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	CloseMessage  = 8
+	PingMessage   = 9
+	PongMessage   = 10
+)
+
+// WebSocket close codes defined in RFC 6455
+const (
+	CloseNormalClosure       = 1000
+	CloseGoingAway           = 1001
+	CloseProtocolError       = 1002
+	CloseUnsupportedData     = 1003
+	CloseNoStatusReceived    = 1005
+	CloseAbnormalClosure     = 1006
+	CloseInvalidPayloadData  = 1007
+	ClosePolicyViolation     = 1008
+	CloseMessageTooBig       = 1009
+	CloseMandatoryExtension  = 1010
+	CloseInternalServerError = 1011
+)
+
+// DefaultMaxMessageSize is the default maximum size of a received message
+const DefaultMaxMessageSize = 1 << 20
+
+const (
+	continuationFrame = 0
+	websocketGUID     = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	maxControlPayload = 125
+)
+
+// some websocket errors
+var (
+	ErrCloseSent      = errors.New("tango: websocket close frame has been sent")
+	ErrMessageTooBig  = errors.New("tango: websocket message is too big")
+	ErrBadHandshake   = errors.New("tango: bad websocket handshake")
+	ErrOriginRejected = errors.New("tango: websocket origin is not allowed")
+)
+
+// CloseError is returned by ReadMessage when the peer closed the connection
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("tango: websocket closed with code %d %s", e.Code, e.Text)
+}
+
+// UpgradeOptions defines the options of Context.Upgrade
+type UpgradeOptions struct {
+	// Subprotocols are the supported protocols in order of preference
+	Subprotocols []string
+	// CheckOrigin returns true if the request Origin is acceptable, if it's
+	// nil, only the requests without Origin or from the same host are accepted.
+	CheckOrigin func(req *http.Request) bool
+	// MaxMessageSize is the maximum size of a received message, a message
+	// exceeding it closes the connection. Default is DefaultMaxMessageSize.
+	MaxMessageSize int64
+}
+
+// WebSocket is a RFC 6455 websocket connection. Only one goroutine should
+// read at a time; WriteMessage, Ping and Close are safe for concurrent use.
+type WebSocket struct {
+	conn        net.Conn
+	br          *bufio.Reader
+	bw          *bufio.Writer
+	subprotocol string
+	maxSize     int64
+	pongHandler func(appData string)
+
+	writeLock sync.Mutex
+	closeSent bool
+	closed    bool
+}
+
+func headerContainsToken(header http.Header, key, token string) bool {
+	for _, v := range header.Values(key) {
+		for _, s := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(s), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func checkSameOrigin(req *http.Request) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, req.Host)
+}
+
+func websocketAccept(key string) string {
+	h := sha1.New()
+	io.WriteString(h, key+websocketGUID)
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// IsWebSocket returns if the request asks for a websocket upgrade
+func (ctx *Context) IsWebSocket() bool {
+	req := ctx.Req()
+	return req.Method == "GET" &&
+		headerContainsToken(req.Header, "Connection", "upgrade") &&
+		headerContainsToken(req.Header, "Upgrade", "websocket")
+}
+
+// Upgrade upgrades the HTTP connection to a websocket. If the handshake
+// fails, an error response has been written and an error is returned. The
+// connection is closed when the action returns, so the action should keep
+// serving the websocket until it's done.
+func (ctx *Context) Upgrade(opts ...UpgradeOptions) (*WebSocket, error) {
+	var opt UpgradeOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.CheckOrigin == nil {
+		opt.CheckOrigin = checkSameOrigin
+	}
+	if opt.MaxMessageSize <= 0 {
+		opt.MaxMessageSize = DefaultMaxMessageSize
+	}
+
+	req := ctx.Req()
+	if !ctx.IsWebSocket() {
+		ctx.Abort(http.StatusBadRequest, "not a websocket handshake")
+		return nil, ErrBadHandshake
+	}
+	if req.Header.Get("Sec-WebSocket-Version") != "13" {
+		ctx.Header().Set("Sec-WebSocket-Version", "13")
+		ctx.Abort(http.StatusUpgradeRequired, "unsupported websocket version")
+		return nil, ErrBadHandshake
+	}
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if k, err := base64.StdEncoding.DecodeString(key); err != nil || len(k) != 16 {
+		ctx.Abort(http.StatusBadRequest, "bad websocket key")
+		return nil, ErrBadHandshake
+	}
+	if !opt.CheckOrigin(req) {
+		ctx.Abort(http.StatusForbidden, "websocket origin is not allowed")
+		return nil, ErrOriginRejected
+	}
+
+	var subprotocol string
+	for _, p := range opt.Subprotocols {
+		if headerContainsToken(req.Header, "Sec-WebSocket-Protocol", p) {
+			subprotocol = p
+			break
+		}
+	}
+
+	conn, rw, err := ctx.Hijack()
+	if err != nil {
+		ctx.Abort(http.StatusInternalServerError, err.Error())
+		return nil, err
+	}
+	// clear the deadlines set by the http server
+	conn.SetDeadline(time.Time{})
+
+	ws := &WebSocket{
+		conn:        conn,
+		br:          rw.Reader,
+		bw:          rw.Writer,
+		subprotocol: subprotocol,
+		maxSize:     opt.MaxMessageSize,
+	}
+
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	rw.WriteString("Sec-WebSocket-Accept: " + websocketAccept(key) + "\r\n")
+	if subprotocol != "" {
+		rw.WriteString("Sec-WebSocket-Protocol: " + subprotocol + "\r\n")
+	}
+	// the headers set by the middlewares, e.g. cookies
+	for k, vs := range ctx.Header() {
+		switch k {
+		case HeaderContentEncoding, HeaderContentLength, HeaderContentType, HeaderVary:
+			continue
+		}
+		for _, v := range vs {
+			rw.WriteString(k + ": " + stripNewlines(v) + "\r\n")
+		}
+	}
+	rw.WriteString("\r\n")
+	if err = rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// record the status for the logging, nothing is written
+	ctx.WriteHeader(http.StatusSwitchingProtocols)
+	ctx.websocket = ws
+	return ws, nil
+}
+
+// Subprotocol returns the negotiated subprotocol
+func (ws *WebSocket) Subprotocol() string {
+	return ws.subprotocol
+}
+
+// RemoteAddr returns the remote network address
+func (ws *WebSocket) RemoteAddr() net.Addr {
+	return ws.conn.RemoteAddr()
+}
+
+// SetReadDeadline sets the deadline of the reading
+func (ws *WebSocket) SetReadDeadline(t time.Time) error {
+	return ws.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline of the writing
+func (ws *WebSocket) SetWriteDeadline(t time.Time) error {
+	return ws.conn.SetWriteDeadline(t)
+}
+
+// SetPongHandler sets the handler called when a pong is received
+func (ws *WebSocket) SetPongHandler(h func(appData string)) {
+	ws.pongHandler = h
+}
+
+func (ws *WebSocket) writeFrame(fin bool, opcode int, payload []byte) error {
+	ws.writeLock.Lock()
+	defer ws.writeLock.Unlock()
+	if ws.closeSent {
+		return ErrCloseSent
+	}
+	if opcode == CloseMessage {
+		ws.closeSent = true
+	}
+
+	var header [10]byte
+	header[0] = byte(opcode)
+	if fin {
+		header[0] |= 0x80
+	}
+	n := 2
+	switch l := len(payload); {
+	case l <= 125:
+		header[1] = byte(l)
+	case l <= 0xffff:
+		header[1] = 126
+		binary.BigEndian.PutUint16(header[2:], uint16(l))
+		n += 2
+	default:
+		header[1] = 127
+		binary.BigEndian.PutUint64(header[2:], uint64(l))
+		n += 8
+	}
+	if _, err := ws.bw.Write(header[:n]); err != nil {
+		return err
+	}
+	if _, err := ws.bw.Write(payload); err != nil {
+		return err
+	}
+	return ws.bw.Flush()
+}
+
+// WriteMessage writes a text or binary message in one frame
+func (ws *WebSocket) WriteMessage(messageType int, data []byte) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return fmt.Errorf("tango: unsupported websocket message type %d", messageType)
+	}
+	return ws.writeFrame(true, messageType, data)
+}
+
+// WriteText writes a text message
+func (ws *WebSocket) WriteText(text string) error {
+	return ws.WriteMessage(TextMessage, []byte(text))
+}
+
+// NextWriter returns a writer of a fragmented message, every Write sends a
+// frame and Close sends the final frame. Other data messages must not be
+// written before the writer is closed.
+func (ws *WebSocket) NextWriter(messageType int) (io.WriteCloser, error) {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return nil, fmt.Errorf("tango: unsupported websocket message type %d", messageType)
+	}
+	return &messageWriter{ws: ws, opcode: messageType}, nil
+}
+
+type messageWriter struct {
+	ws     *WebSocket
+	opcode int
+}
+
+func (w *messageWriter) Write(p []byte) (int, error) {
+	if err := w.ws.writeFrame(false, w.opcode, p); err != nil {
+		return 0, err
+	}
+	w.opcode = continuationFrame
+	return len(p), nil
+}
+
+func (w *messageWriter) Close() error {
+	return w.ws.writeFrame(true, w.opcode, nil)
+}
+
+// Ping sends a ping control frame
+func (ws *WebSocket) Ping(data []byte) error {
+	if len(data) > maxControlPayload {
+		return ErrMessageTooBig
+	}
+	return ws.writeFrame(true, PingMessage, data)
+}
+
+func closePayload(code int, text string) []byte {
+	if code == CloseNoStatusReceived {
+		return nil
+	}
+	if len(text) > maxControlPayload-2 {
+		text = text[:maxControlPayload-2]
+	}
+	payload := make([]byte, 2+len(text))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	copy(payload[2:], text)
+	return payload
+}
+
+// CloseWithCode sends a close frame with code and text, then closes the
+// connection
+func (ws *WebSocket) CloseWithCode(code int, text string) error {
+	err := ws.writeFrame(true, CloseMessage, closePayload(code, text))
+	if err == ErrCloseSent {
+		err = nil
+	}
+	if cerr := ws.closeConn(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Close closes the websocket with a normal closure
+func (ws *WebSocket) Close() error {
+	return ws.CloseWithCode(CloseNormalClosure, "")
+}
+
+func (ws *WebSocket) closeConn() error {
+	ws.writeLock.Lock()
+	defer ws.writeLock.Unlock()
+	if ws.closed {
+		return nil
+	}
+	ws.closed = true
+	return ws.conn.Close()
+}
+
+// fail closes the connection because of a protocol violation
+func (ws *WebSocket) fail(code int, err error) error {
+	ws.CloseWithCode(code, err.Error())
+	return err
+}
+
+type frameHeader struct {
+	fin    bool
+	opcode int
+	length int64
+	mask   [4]byte
+}
+
+func (ws *WebSocket) readFrameHeader() (frameHeader, error) {
+	var h frameHeader
+	var b [8]byte
+	if _, err := io.ReadFull(ws.br, b[:2]); err != nil {
+		return h, err
+	}
+	h.fin = b[0]&0x80 != 0
+	h.opcode = int(b[0] & 0x0f)
+	if b[0]&0x70 != 0 {
+		return h, ws.fail(CloseProtocolError, errors.New("tango: websocket reserved bits are set"))
+	}
+	if b[1]&0x80 == 0 {
+		return h, ws.fail(CloseProtocolError, errors.New("tango: websocket client frame is not masked"))
+	}
+
+	h.length = int64(b[1] & 0x7f)
+	switch h.length {
+	case 126:
+		if _, err := io.ReadFull(ws.br, b[:2]); err != nil {
+			return h, err
+		}
+		h.length = int64(binary.BigEndian.Uint16(b[:2]))
+	case 127:
+		if _, err := io.ReadFull(ws.br, b[:8]); err != nil {
+			return h, err
+		}
+		if b[0]&0x80 != 0 {
+			return h, ws.fail(CloseProtocolError, errors.New("tango: websocket frame length is invalid"))
+		}
+		h.length = int64(binary.BigEndian.Uint64(b[:8]))
+	}
+
+	if _, err := io.ReadFull(ws.br, h.mask[:]); err != nil {
+		return h, err
+	}
+
+	switch h.opcode {
+	case continuationFrame, TextMessage, BinaryMessage:
+	case CloseMessage, PingMessage, PongMessage:
+		if !h.fin || h.length > maxControlPayload {
+			return h, ws.fail(CloseProtocolError, errors.New("tango: websocket control frame is invalid"))
+		}
+	default:
+		return h, ws.fail(CloseProtocolError, fmt.Errorf("tango: websocket opcode %d is unknown", h.opcode))
+	}
+	return h, nil
+}
+
+func (ws *WebSocket) readPayload(h frameHeader, dst []byte) ([]byte, error) {
+	start := len(dst)
+	dst = append(dst, make([]byte, h.length)...)
+	if _, err := io.ReadFull(ws.br, dst[start:]); err != nil {
+		return nil, err
+	}
+	for i := range dst[start:] {
+		dst[start+i] ^= h.mask[i%4]
+	}
+	return dst, nil
+}
+
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1011:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
+
+// ReadMessage reads the next text or binary message, the fragmented frames
+// are joined. The pings are answered and the pongs are passed to the pong
+// handler while reading. When the peer closes the connection, the close is
+// answered and a *CloseError is returned.
+func (ws *WebSocket) ReadMessage() (messageType int, data []byte, err error) {
+	for {
+		h, err := ws.readFrameHeader()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch h.opcode {
+		case PingMessage:
+			payload, err := ws.readPayload(h, nil)
+			if err != nil {
+				return 0, nil, err
+			}
+			if err = ws.writeFrame(true, PongMessage, payload); err != nil && err != ErrCloseSent {
+				return 0, nil, err
+			}
+			continue
+		case PongMessage:
+			payload, err := ws.readPayload(h, nil)
+			if err != nil {
+				return 0, nil, err
+			}
+			if ws.pongHandler != nil {
+				ws.pongHandler(string(payload))
+			}
+			continue
+		case CloseMessage:
+			payload, err := ws.readPayload(h, nil)
+			if err != nil {
+				return 0, nil, err
+			}
+			closeErr := &CloseError{Code: CloseNoStatusReceived}
+			switch {
+			case len(payload) == 1:
+				return 0, nil, ws.fail(CloseProtocolError, errors.New("tango: websocket close frame is invalid"))
+			case len(payload) >= 2:
+				closeErr.Code = int(binary.BigEndian.Uint16(payload))
+				closeErr.Text = string(payload[2:])
+				if !validCloseCode(closeErr.Code) || !utf8.ValidString(closeErr.Text) {
+					return 0, nil, ws.fail(CloseProtocolError, errors.New("tango: websocket close frame is invalid"))
+				}
+			}
+			// echo the close and end the connection
+			ws.CloseWithCode(closeErr.Code, "")
+			return 0, nil, closeErr
+		case continuationFrame:
+			if messageType == 0 {
+				return 0, nil, ws.fail(CloseProtocolError, errors.New("tango: websocket continuation frame is unexpected"))
+			}
+		default:
+			if messageType != 0 {
+				return 0, nil, ws.fail(CloseProtocolError, errors.New("tango: websocket fragmented message is not finished"))
+			}
+			messageType = h.opcode
+		}
+
+		if h.length > ws.maxSize-int64(len(data)) {
+			return 0, nil, ws.fail(CloseMessageTooBig, ErrMessageTooBig)
+		}
+		if data, err = ws.readPayload(h, data); err != nil {
+			return 0, nil, err
+		}
+		if h.fin {
+			if messageType == TextMessage && !utf8.Valid(data) {
+				return 0, nil, ws.fail(CloseInvalidPayloadData, errors.New("tango: websocket text message is not valid UTF-8"))
+			}
+			return messageType, data, nil
+		}
+	}
+}
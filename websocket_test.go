@@ -0,0 +1,308 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tango
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type wsClient struct {
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+func dialWebSocket(t *testing.T, srv *httptest.Server, header string) (*wsClient, *http.Response) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: "+strings.TrimPrefix(srv.URL, "http://")+
+		"\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n"+header+"\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &wsClient{conn, br}, resp
+}
+
+func (c *wsClient) writeFrame(t *testing.T, fin bool, opcode int, payload []byte) {
+	var buf bytes.Buffer
+	b0 := byte(opcode)
+	if fin {
+		b0 |= 0x80
+	}
+	buf.WriteByte(b0)
+	switch {
+	case len(payload) <= 125:
+		buf.WriteByte(0x80 | byte(len(payload)))
+	case len(payload) <= 0xffff:
+		buf.WriteByte(0x80 | 126)
+		binary.Write(&buf, binary.BigEndian, uint16(len(payload)))
+	default:
+		buf.WriteByte(0x80 | 127)
+		binary.Write(&buf, binary.BigEndian, uint64(len(payload)))
+	}
+	mask := []byte{1, 2, 3, 4}
+	buf.Write(mask)
+	for i, b := range payload {
+		buf.WriteByte(b ^ mask[i%4])
+	}
+	if _, err := c.conn.Write(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeFrameHeader writes the header of a final frame declaring a 64-bit
+// payload length, without the payload
+func (c *wsClient) writeFrameHeader(t *testing.T, opcode int, length uint64) {
+	var buf bytes.Buffer
+	buf.WriteByte(0x80 | byte(opcode))
+	buf.WriteByte(0x80 | 127)
+	binary.Write(&buf, binary.BigEndian, length)
+	buf.Write([]byte{1, 2, 3, 4})
+	if _, err := c.conn.Write(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (c *wsClient) readFrame(t *testing.T) (bool, int, []byte) {
+	var h [2]byte
+	if _, err := io.ReadFull(c.br, h[:]); err != nil {
+		t.Fatal(err)
+	}
+	if h[1]&0x80 != 0 {
+		t.Fatal("server frame should not be masked")
+	}
+	length := int(h[1] & 0x7f)
+	switch length {
+	case 126:
+		var l uint16
+		binary.Read(c.br, binary.BigEndian, &l)
+		length = int(l)
+	case 127:
+		var l uint64
+		binary.Read(c.br, binary.BigEndian, &l)
+		length = int(l)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		t.Fatal(err)
+	}
+	return h[0]&0x80 != 0, int(h[0] & 0x0f), payload
+}
+
+func (c *wsClient) expectClose(t *testing.T, code int) {
+	_, opcode, payload := c.readFrame(t)
+	expect(t, opcode, CloseMessage)
+	expect(t, int(binary.BigEndian.Uint16(payload)), code)
+}
+
+func closeFrame(code int, text string) []byte {
+	payload := make([]byte, 2+len(text))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	copy(payload[2:], text)
+	return payload
+}
+
+func newEchoServer(t *testing.T, logger Logger, opts ...UpgradeOptions) (*httptest.Server, chan error, chan bool) {
+	result := make(chan error, 1)
+	served := make(chan bool, 10)
+	o := NewWithLog(logger, ClassicHandlers...)
+	o.Get("/", func(ctx *Context) {
+		ws, err := ctx.Upgrade(opts...)
+		if err != nil {
+			result <- err
+			return
+		}
+		ws.SetPongHandler(func(data string) {
+			ws.WriteText("pong " + data)
+		})
+		for {
+			tp, data, err := ws.ReadMessage()
+			if err != nil {
+				result <- err
+				return
+			}
+			if string(data) == "panic" {
+				panic("websocket panic")
+			}
+			if string(data) == "fragments" {
+				w, _ := ws.NextWriter(TextMessage)
+				io.WriteString(w, "frag")
+				io.WriteString(w, "ments")
+				w.Close()
+				continue
+			}
+			ws.WriteMessage(tp, data)
+		}
+	})
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		o.ServeHTTP(w, req)
+		served <- true
+	})), result, served
+}
+
+func TestWebSocketEcho(t *testing.T) {
+	var buf bytes.Buffer
+	srv, result, served := newEchoServer(t, NewLogger(&buf), UpgradeOptions{Subprotocols: []string{"chat"}})
+	defer srv.Close()
+
+	c, resp := dialWebSocket(t, srv, "Sec-WebSocket-Version: 13\r\nSec-WebSocket-Protocol: superchat, chat\r\n")
+	expect(t, resp.StatusCode, http.StatusSwitchingProtocols)
+	expect(t, resp.Header.Get("Sec-WebSocket-Accept"), "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=")
+	expect(t, resp.Header.Get("Sec-WebSocket-Protocol"), "chat")
+
+	c.writeFrame(t, true, TextMessage, []byte("hello"))
+	fin, opcode, payload := c.readFrame(t)
+	expect(t, fin, true)
+	expect(t, opcode, TextMessage)
+	expect(t, string(payload), "hello")
+
+	// a fragmented binary message with a ping between the fragments
+	big := bytes.Repeat([]byte{7}, 70000)
+	c.writeFrame(t, false, BinaryMessage, big[:100])
+	c.writeFrame(t, true, PingMessage, []byte("ping"))
+	c.writeFrame(t, true, continuationFrame, big[100:])
+	_, opcode, payload = c.readFrame(t)
+	expect(t, opcode, PongMessage)
+	expect(t, string(payload), "ping")
+	_, opcode, payload = c.readFrame(t)
+	expect(t, opcode, BinaryMessage)
+	expect(t, bytes.Equal(payload, big), true)
+
+	c.writeFrame(t, true, PongMessage, []byte("beat"))
+	_, _, payload = c.readFrame(t)
+	expect(t, string(payload), "pong beat")
+
+	c.writeFrame(t, true, TextMessage, []byte("fragments"))
+	fin, opcode, payload = c.readFrame(t)
+	expect(t, fin, false)
+	expect(t, opcode, TextMessage)
+	expect(t, string(payload), "frag")
+	fin, opcode, payload = c.readFrame(t)
+	expect(t, fin, false)
+	expect(t, opcode, continuationFrame)
+	expect(t, string(payload), "ments")
+	fin, opcode, _ = c.readFrame(t)
+	expect(t, fin, true)
+	expect(t, opcode, continuationFrame)
+
+	// close handshake
+	c.writeFrame(t, true, CloseMessage, closeFrame(CloseGoingAway, "bye"))
+	c.expectClose(t, CloseGoingAway)
+	err := <-result
+	closeErr, ok := err.(*CloseError)
+	expect(t, ok, true)
+	expect(t, closeErr.Code, CloseGoingAway)
+	expect(t, closeErr.Text, "bye")
+
+	_, err = c.br.ReadByte()
+	expect(t, err, io.EOF)
+
+	<-served
+	expect(t, strings.Contains(buf.String(), "status=101"), true)
+	expect(t, strings.Contains(buf.String(), "[Error]"), false)
+}
+
+func TestWebSocketMessageTooBig(t *testing.T) {
+	srv, result, _ := newEchoServer(t, NewLogger(io.Discard), UpgradeOptions{MaxMessageSize: 10})
+	defer srv.Close()
+
+	c, resp := dialWebSocket(t, srv, "Sec-WebSocket-Version: 13\r\n")
+	expect(t, resp.StatusCode, http.StatusSwitchingProtocols)
+
+	c.writeFrame(t, false, TextMessage, []byte("012345"))
+	c.writeFrame(t, true, continuationFrame, []byte("6789a"))
+	c.expectClose(t, CloseMessageTooBig)
+	expect(t, <-result, ErrMessageTooBig)
+
+	// the declared length must not overflow the size check
+	c, _ = dialWebSocket(t, srv, "Sec-WebSocket-Version: 13\r\n")
+	c.writeFrame(t, false, TextMessage, []byte("a"))
+	c.writeFrameHeader(t, continuationFrame, 1<<63-1)
+	c.expectClose(t, CloseMessageTooBig)
+	expect(t, <-result, ErrMessageTooBig)
+
+	// the most significant bit of a 64-bit length must be 0
+	c, _ = dialWebSocket(t, srv, "Sec-WebSocket-Version: 13\r\n")
+	c.writeFrameHeader(t, TextMessage, 1<<63)
+	c.expectClose(t, CloseProtocolError)
+	refute(t, <-result, nil)
+}
+
+func TestWebSocketProtocolErrors(t *testing.T) {
+	srv, result, _ := newEchoServer(t, NewLogger(io.Discard))
+	defer srv.Close()
+
+	c, _ := dialWebSocket(t, srv, "Sec-WebSocket-Version: 13\r\n")
+	c.writeFrame(t, true, continuationFrame, []byte("orphan"))
+	c.expectClose(t, CloseProtocolError)
+	refute(t, <-result, nil)
+
+	c, _ = dialWebSocket(t, srv, "Sec-WebSocket-Version: 13\r\n")
+	c.writeFrame(t, true, TextMessage, []byte{0xff, 0xfe})
+	c.expectClose(t, CloseInvalidPayloadData)
+	refute(t, <-result, nil)
+
+	c, _ = dialWebSocket(t, srv, "Sec-WebSocket-Version: 13\r\n")
+	c.writeFrame(t, false, PingMessage, nil)
+	c.expectClose(t, CloseProtocolError)
+	refute(t, <-result, nil)
+}
+
+func TestWebSocketBadHandshake(t *testing.T) {
+	srv, result, _ := newEchoServer(t, NewLogger(io.Discard))
+	defer srv.Close()
+
+	_, resp := dialWebSocket(t, srv, "Sec-WebSocket-Version: 8\r\n")
+	expect(t, resp.StatusCode, http.StatusUpgradeRequired)
+	expect(t, resp.Header.Get("Sec-WebSocket-Version"), "13")
+	expect(t, <-result, ErrBadHandshake)
+
+	_, resp = dialWebSocket(t, srv, "Sec-WebSocket-Version: 13\r\nOrigin: http://evil.com\r\n")
+	expect(t, resp.StatusCode, http.StatusForbidden)
+	expect(t, <-result, ErrOriginRejected)
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	expect(t, resp.StatusCode, http.StatusBadRequest)
+	expect(t, <-result, ErrBadHandshake)
+}
+
+func TestWebSocketRecovery(t *testing.T) {
+	var buf bytes.Buffer
+	srv, _, served := newEchoServer(t, NewLogger(&buf))
+	defer srv.Close()
+
+	c, resp := dialWebSocket(t, srv, "Sec-WebSocket-Version: 13\r\n")
+	expect(t, resp.StatusCode, http.StatusSwitchingProtocols)
+
+	c.writeFrame(t, true, TextMessage, []byte("panic"))
+	c.expectClose(t, CloseNormalClosure)
+	_, err := c.br.ReadByte()
+	expect(t, err, io.EOF)
+
+	<-served
+	expect(t, strings.Contains(buf.String(), "websocket panic"), true)
+	expect(t, strings.Contains(buf.String(), "hijacked"), false)
+}